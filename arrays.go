@@ -0,0 +1,246 @@
+package script
+
+import (
+    "unicode/utf8"
+)
+
+// Arrays are mutable sequences of values, indexed from 0. They are created by
+// Array.new, which takes the elements as arguments.
+//
+// Anything with an iterator member can be iterated over. Iterators have
+// hasNext, which returns whether there are more elements, and next, which
+// returns the next element. An iterator's own iterator member returns itself.
+func (e *Interpreter) initArrays() {
+    cs := e.builtins.classes
+    cs.Array.val.(*class).newFn = newArray
+    e.defineBuiltins(cs.Array, []builtinMember{
+        {"length", arrayPrimitive(0, arrayLength)},
+        {"at", arrayPrimitive(1, arrayAt)},
+        {"put", arrayPrimitive(2, arrayPut)},
+        {"append", arrayPrimitive(1, arrayAppend)},
+        {"slice", arrayPrimitive(2, arraySlice)},
+        {"insert", arrayPrimitive(2, arrayInsert)},
+        {"remove", arrayPrimitive(1, arrayRemove)},
+        {"concat", arrayPrimitive(1, arrayConcat)},
+        {"reverse", arrayPrimitive(0, arrayReverse)},
+        {"sort", arrayPrimitive(1, arraySort)},
+        {"iterator", arrayPrimitive(0, arrayIterator)},
+    })
+    e.defineBuiltins(cs.Iterator, []builtinMember{
+        {"hasNext", iteratorHasNext},
+        {"next", iteratorNext},
+        {"iterator", getSelf},
+    })
+}
+
+// Array.new(xs...) makes an array of its arguments.
+func newArray(p *Process) Action {
+    return Return(Array(p.Args()...))
+}
+
+var errIndex = String("index out of range")
+
+// Check the receiver and the number of arguments before calling fn.
+func arrayPrimitive(argc int, fn func(p *Process, a *[]V, args []V) Action) Primitive {
+    return func(p *Process) Action {
+        a, ok := p.Receiver().AsArray()
+        if !ok {
+            return Throw(String("receiver: expected Array"))
+        }
+        args := p.Args()
+        if len(args) != argc {
+            return Throw(String("wrong number of arguments"))
+        }
+        return fn(p, a, args)
+    }
+}
+
+// Convert an argument to an index in [0, limit].
+func indexArg(x V, limit int) (int, Action, bool) {
+    i, ok := x.AsInt()
+    if !ok {
+        return 0, Throw(String("index must be an Integer")), false
+    }
+    if i < 0 || i > int64(limit) {
+        return 0, Throw(errIndex), false
+    }
+    return int(i), Action{}, true
+}
+
+func arrayLength(p *Process, a *[]V, args []V) Action {
+    return Return(Int(int64(len(*a))))
+}
+
+func arrayAt(p *Process, a *[]V, args []V) Action {
+    i, err, ok := indexArg(args[0], len(*a)-1)
+    if !ok {
+        return err
+    }
+    return Return((*a)[i])
+}
+
+func arrayPut(p *Process, a *[]V, args []V) Action {
+    i, err, ok := indexArg(args[0], len(*a)-1)
+    if !ok {
+        return err
+    }
+    (*a)[i] = args[1]
+    return Return(V{})
+}
+
+func arrayAppend(p *Process, a *[]V, args []V) Action {
+    *a = append(*a, args[0])
+    return Return(V{a})
+}
+
+// slice(from, to) copies the elements from from up to, but not including, to.
+func arraySlice(p *Process, a *[]V, args []V) Action {
+    from, err, ok := indexArg(args[0], len(*a))
+    if !ok {
+        return err
+    }
+    to, err, ok := indexArg(args[1], len(*a))
+    if !ok {
+        return err
+    }
+    if to < from {
+        return Throw(errIndex)
+    }
+    return Return(Array((*a)[from:to]...))
+}
+
+// insert(i, x) puts x before the element at i, or at the end if i is the
+// length of the array.
+func arrayInsert(p *Process, a *[]V, args []V) Action {
+    i, err, ok := indexArg(args[0], len(*a))
+    if !ok {
+        return err
+    }
+    *a = append(*a, V{})
+    copy((*a)[i+1:], (*a)[i:])
+    (*a)[i] = args[1]
+    return Return(V{a})
+}
+
+// remove(i) takes out the element at i and returns it.
+func arrayRemove(p *Process, a *[]V, args []V) Action {
+    i, err, ok := indexArg(args[0], len(*a)-1)
+    if !ok {
+        return err
+    }
+    x := (*a)[i]
+    end := len(*a)-1
+    copy((*a)[i:], (*a)[i+1:])
+    // Let go of the last element, which has been copied down.
+    (*a)[end] = V{}
+    *a = (*a)[:end]
+    return Return(x)
+}
+
+func arrayConcat(p *Process, a *[]V, args []V) Action {
+    b, ok := args[0].AsArray()
+    if !ok {
+        return Throw(String("argument 1: expected Array"))
+    }
+    res := append(append([]V{}, *a...), *b...)
+    return Return(V{&res})
+}
+
+func arrayReverse(p *Process, a *[]V, args []V) Action {
+    xs := *a
+    for i, j := 0, len(xs)-1; i < j; i, j = i+1, j-1 {
+        xs[i], xs[j] = xs[j], xs[i]
+    }
+    return Return(V{a})
+}
+
+// sort(cmp) sorts the array in place. The comparator is called with two
+// elements and returns a negative Integer if the first should come before the
+// second. The sort is stable.
+//
+// This is an insertion sort that finds where each element goes by binary
+// search, so it makes few calls to the comparator. The array is only updated
+// once all the comparisons have been made.
+func arraySort(p *Process, a *[]V, args []V) Action {
+    cmp := args[0]
+    if len(*a) < 2 {
+        return Return(V{a})
+    }
+    xs := append([]V{}, *a...)
+    i, lo, hi, mid := 0, 0, 0, 0
+    var compared Continuation
+    step := func() Action {
+        for lo == hi {
+            x := xs[i]
+            copy(xs[lo+1:i+1], xs[lo:i])
+            xs[lo] = x
+            i++
+            if i >= len(xs) {
+                *a = xs
+                return Return(V{a})
+            }
+            lo, hi = 0, i
+        }
+        mid = (lo+hi) / 2
+        return CallThen(compared, cmp, V{}, xs[i], xs[mid])
+    }
+    compared = func(p *Process, res V) Action {
+        n, ok := res.AsInt()
+        if !ok {
+            return Throw(String("comparator must return an Integer"))
+        }
+        if n < 0 {
+            hi = mid
+        } else {
+            lo = mid+1
+        }
+        return step()
+    }
+    return step()
+}
+
+func arrayIterator(p *Process, a *[]V, args []V) Action {
+    return Return(p.host.newIterator(V{a}))
+}
+
+// Iterators hold what they are iterating over and the index of the next
+// element.
+func (host *Interpreter) newIterator(x V) V {
+    return V{&UserObject{host.builtins.classes.Iterator, []V{x, Int(0)}}}
+}
+
+// Find the element of x at index i and the index of the element after it. The
+// result is false if there are no more elements. Strings are indexed by byte
+// and their elements are runes.
+func elementAt(x V, i int) (V, int, bool) {
+    switch xv := x.val.(type) {
+    case *[]V:
+        if i < len(*xv) {
+            return (*xv)[i], i+1, true
+        }
+    case string:
+        if i < len(xv) {
+            r, size := utf8.DecodeRuneInString(xv[i:])
+            return String(string(r)), i+size, true
+        }
+    }
+    return V{}, i, false
+}
+
+func iteratorHasNext(p *Process) Action {
+    it := p.Receiver().val.(*UserObject)
+    i, _ := it.fields[1].AsInt()
+    _, _, ok := elementAt(it.fields[0], int(i))
+    return Return(Bool(ok))
+}
+
+func iteratorNext(p *Process) Action {
+    it := p.Receiver().val.(*UserObject)
+    i, _ := it.fields[1].AsInt()
+    x, next, ok := elementAt(it.fields[0], int(i))
+    if !ok {
+        return Throw(String("no more elements"))
+    }
+    it.fields[1] = Int(int64(next))
+    return Return(x)
+}
@@ -0,0 +1,160 @@
+package script
+
+import (
+    "testing"
+)
+
+func arrayOf(xs ...int64) V {
+    var vs []V
+    for _, x := range xs {
+        vs = append(vs, Int(x))
+    }
+    return Array(vs...)
+}
+
+func sameArray(x, y V) bool {
+    a, aok := x.AsArray()
+    b, bok := y.AsArray()
+    if !aok || !bok || len(*a) != len(*b) {
+        return false
+    }
+    for i := range *a {
+        if (*a)[i] != (*b)[i] {
+            return false
+        }
+    }
+    return true
+}
+
+func TestArrays(t *testing.T) {
+    host := New()
+    send := func(recv V, name string, args ...V) (V, error) {
+        return host.Run(sendUnit(recv, host.Intern(name), args...), 0, V{})
+    }
+    subtract := V{Primitive(func(p *Process) Action {
+        x, _ := p.Args()[0].AsInt()
+        y, _ := p.Args()[1].AsInt()
+        return Return(Int(x-y))
+    })}
+    for i, test := range ([]struct{recv V; name string; args []V; result, after V; thrown string}{
+        {host.builtins.classes.Array, "new", []V{Int(1), Int(2)}, arrayOf(1, 2), V{}, ""},
+        {arrayOf(1, 2, 3), "length", nil, Int(3), arrayOf(1, 2, 3), ""},
+        {arrayOf(1, 2, 3), "at", []V{Int(1)}, Int(2), arrayOf(1, 2, 3), ""},
+        {arrayOf(1, 2, 3), "at", []V{Int(3)}, V{}, V{}, "index out of range"},
+        {arrayOf(1, 2, 3), "at", []V{Int(-1)}, V{}, V{}, "index out of range"},
+        {arrayOf(1, 2, 3), "at", []V{String("a")}, V{}, V{}, "index must be an Integer"},
+        {arrayOf(1, 2, 3), "put", []V{Int(0), Int(5)}, V{}, arrayOf(5, 2, 3), ""},
+        {arrayOf(1, 2, 3), "put", []V{Int(3), Int(5)}, V{}, V{}, "index out of range"},
+        {arrayOf(1), "append", []V{Int(2)}, arrayOf(1, 2), arrayOf(1, 2), ""},
+        {arrayOf(1, 2, 3, 4), "slice", []V{Int(1), Int(3)}, arrayOf(2, 3), arrayOf(1, 2, 3, 4), ""},
+        {arrayOf(1, 2, 3, 4), "slice", []V{Int(4), Int(4)}, arrayOf(), arrayOf(1, 2, 3, 4), ""},
+        {arrayOf(1, 2, 3, 4), "slice", []V{Int(3), Int(1)}, V{}, V{}, "index out of range"},
+        {arrayOf(1, 3), "insert", []V{Int(1), Int(2)}, arrayOf(1, 2, 3), arrayOf(1, 2, 3), ""},
+        {arrayOf(1, 2), "insert", []V{Int(2), Int(3)}, arrayOf(1, 2, 3), arrayOf(1, 2, 3), ""},
+        {arrayOf(1, 2, 3), "remove", []V{Int(1)}, Int(2), arrayOf(1, 3), ""},
+        {arrayOf(), "remove", []V{Int(0)}, V{}, V{}, "index out of range"},
+        {arrayOf(1, 2), "concat", []V{arrayOf(3)}, arrayOf(1, 2, 3), arrayOf(1, 2), ""},
+        {arrayOf(1, 2), "concat", []V{Int(3)}, V{}, V{}, "argument 1: expected Array"},
+        {arrayOf(1, 2, 3), "reverse", nil, arrayOf(3, 2, 1), arrayOf(3, 2, 1), ""},
+        {arrayOf(), "sort", []V{subtract}, arrayOf(), arrayOf(), ""},
+        {arrayOf(5, 3, 9, 1, 1, 8, 2, 7, 0, 4, 6), "sort", []V{subtract}, arrayOf(0, 1, 1, 2, 3, 4, 5, 6, 7, 8, 9), arrayOf(0, 1, 1, 2, 3, 4, 5, 6, 7, 8, 9), ""},
+        {arrayOf(1, 2), "length", []V{Int(1)}, V{}, V{}, "wrong number of arguments"},
+    }) {
+        result, err := send(test.recv, test.name, test.args...)
+        if test.thrown != "" {
+            if serr, ok := err.(*ScriptError); !ok || serr.Value != String(test.thrown) {
+                t.Errorf("[%d]: unexpected error %v", i, err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("[%d]: unexpected error %v", i, err)
+            continue
+        }
+        if _, ok := test.result.AsArray(); ok {
+            if !sameArray(result, test.result) {
+                t.Errorf("[%d]: %v != %v", i, result, test.result)
+            }
+        } else if result != test.result {
+            t.Errorf("[%d]: %#v != %#v", i, result, test.result)
+        }
+        if test.after.val != nil && !sameArray(test.recv, test.after) {
+            t.Errorf("[%d]: array is %v, expected %v", i, test.recv, test.after)
+        }
+    }
+}
+
+func TestArrayRemoveReleases(t *testing.T) {
+    host := New()
+    a := arrayOf(1, 2, 3)
+    if _, err := host.Run(sendUnit(a, host.Intern("remove"), Int(0)), 0, V{}); err != nil {
+        t.Fatal(err)
+    }
+    xs, _ := a.AsArray()
+    if last := (*xs)[:3][2]; last != (V{}) {
+        t.Errorf("removed slot still holds %#v", last)
+    }
+}
+
+func TestArraySortScript(t *testing.T) {
+    host := New()
+    u, a := assembleUnit(t, host, `
+        .method same 2
+            GLOBAL 0
+            RETURN
+        .method bad 2
+            GLOBAL "x"
+            RETURN
+        .method sort 2
+            BOUND 1
+            PUSH
+            BOUND 0
+            LOOKUP sort
+            TCALL 1
+    `)
+    entry := func(name string) int {
+        id, _ := a.Entry(name)
+        return id
+    }
+    xs := arrayOf(3, 1, 2)
+    result, err := host.Run(u, entry("sort"), V{}, xs, u.Values[entry("same")])
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !sameArray(result, arrayOf(3, 1, 2)) {
+        t.Errorf("sort was not stable: %v", result)
+    }
+    _, err = host.Run(u, entry("sort"), V{}, xs, u.Values[entry("bad")])
+    if serr, ok := err.(*ScriptError); !ok || serr.Value != String("comparator must return an Integer") {
+        t.Errorf("unexpected error %v", err)
+    }
+    if !sameArray(xs, arrayOf(3, 1, 2)) {
+        t.Errorf("failed sort changed the array: %v", xs)
+    }
+}
+
+func TestArrayIterator(t *testing.T) {
+    host := New()
+    send := func(recv V, name string) V {
+        result, err := host.Run(sendUnit(recv, host.Intern(name)), 0, V{})
+        if err != nil {
+            t.Fatal(err)
+        }
+        return result
+    }
+    it := send(arrayOf(1, 2), "iterator")
+    if send(it, "iterator") != it {
+        t.Error("an iterator should be its own iterator")
+    }
+    var got []V
+    for send(it, "hasNext").AsBool() {
+        got = append(got, send(it, "next"))
+    }
+    if !sameArray(Array(got...), arrayOf(1, 2)) {
+        t.Errorf("iterated %v", got)
+    }
+    _, err := host.Run(sendUnit(it, host.Intern("next")), 0, V{})
+    if serr, ok := err.(*ScriptError); !ok || serr.Value != String("no more elements") {
+        t.Errorf("unexpected error %v", err)
+    }
+}
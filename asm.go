@@ -0,0 +1,521 @@
+package script
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+
+    "github.com/bobappleyard/script/bytecode"
+)
+
+// The result of assembling a listing: an image together with the item ids of
+// the methods and classes that the listing defined.
+type Assembly struct {
+    writer *bytecode.Writer
+    entries map[string]int
+}
+
+// Reported when a listing cannot be assembled.
+type AsmError struct {
+    Line int
+    Msg string
+}
+
+func (e *AsmError) Error() string {
+    return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Write the assembly as a bytecode image.
+func (a *Assembly) WriteTo(w io.Writer) (int64, error) {
+    return a.writer.WriteTo(w)
+}
+
+// The item id of a method or class defined by the listing, for use as an entry
+// point. Methods defined inside a class are named Class.method.
+func (a *Assembly) Entry(name string) (int, bool) {
+    id, ok := a.entries[name]
+    return id, ok
+}
+
+// Load the assembly in the same way as an image.
+func (host *Interpreter) LoadAssembly(a *Assembly) (*Unit, error) {
+    buf := new(bytes.Buffer)
+    if _, err := a.WriteTo(buf); err != nil {
+        return nil, err
+    }
+    return host.Load(buf)
+}
+
+// Assemble a listing into an image.
+//
+// Each line holds a directive, an instruction or a label followed by a colon.
+// Comments start with a semicolon. Instructions are written using the names of
+// the opcodes. The directives are:
+//
+//     .const name value     name a constant
+//     .method name argc     start a method
+//     .class name [base]    start a class, optionally deriving from another
+//     .field name           declare a field of the current class
+//     .end                  end the current class
+//     .package path         declare the package the image belongs to
+//     .import name path     name the package with the given path
+//     .export name          export a constant, method or class
+//
+// The operands of JUMP, BRANCH and FRAME may be labels within the method. The
+// operand of GLOBAL may be an integer, float or quoted string, or the name of
+// a constant, import, method or class. The operand of LOOKUP is the member
+// name, which may be quoted. Methods that appear inside a class are members of
+// it.
+func Assemble(src string) (*Assembly, error) {
+    a := &assembler{
+        writer: bytecode.NewWriter(ImageLayout),
+        consts: map[string]asmConst{},
+        atoms: map[interface{}]bytecode.ItemId{},
+        names: map[string]bytecode.ItemId{},
+        entries: map[string]int{},
+        importIds: map[string]bytecode.ItemId{},
+    }
+    if err := a.parse(src); err != nil {
+        return nil, err
+    }
+    if err := a.emit(); err != nil {
+        return nil, err
+    }
+    return &Assembly{a.writer, a.entries}, nil
+}
+
+type assembler struct {
+    writer *bytecode.Writer
+    consts map[string]asmConst
+    methods []*asmMethod
+    classes []*asmClass
+    atoms map[interface{}]bytecode.ItemId
+    names map[string]bytecode.ItemId
+    entries map[string]int
+    pkg string
+    imports []asmImport
+    importIds map[string]bytecode.ItemId
+    exports []asmExport
+}
+
+type asmImport struct {
+    line int
+    name, path string
+}
+
+type asmExport struct {
+    line int
+    name string
+}
+
+type asmConst struct {
+    line int
+    value interface{}
+}
+
+type asmMethod struct {
+    line int
+    name, entry string
+    argc int
+    instrs []asmInstr
+    labels map[string]int
+    id bytecode.ItemId
+}
+
+type asmInstr struct {
+    line int
+    op int
+    arg string
+}
+
+type asmClass struct {
+    line int
+    name, ancestor string
+    fields []string
+    methods []*asmMethod
+    id bytecode.ItemId
+}
+
+var opcodeNames = map[string]int{}
+
+func init() {
+    for op, info := range opcodes {
+        opcodeNames[info.name] = op
+    }
+}
+
+func (a *assembler) parse(src string) error {
+    var cls *asmClass
+    var m *asmMethod
+    for i, line := range strings.Split(src, "\n") {
+        lineNo := i+1
+        fail := func(format string, args ...interface{}) error {
+            return &AsmError{lineNo, fmt.Sprintf(format, args...)}
+        }
+        line = strings.TrimSpace(stripComment(line))
+        if line == "" {
+            continue
+        }
+        if strings.HasSuffix(line, ":") {
+            label := strings.TrimSuffix(line, ":")
+            if m == nil {
+                return fail("label outside method")
+            }
+            if _, ok := m.labels[label]; ok {
+                return fail("duplicate label %s", label)
+            }
+            m.labels[label] = len(m.instrs)
+            continue
+        }
+        word, rest := splitWord(line)
+        switch word {
+        case ".const":
+            name, lit := splitWord(rest)
+            if !isIdent(name) {
+                return fail("bad constant name %q", name)
+            }
+            if _, ok := a.consts[name]; ok {
+                return fail("duplicate constant %s", name)
+            }
+            value, ok := parseLiteral(lit)
+            if !ok {
+                return fail("bad constant value %q", lit)
+            }
+            a.consts[name] = asmConst{lineNo, value}
+        case ".method":
+            name, argcStr := splitWord(rest)
+            argc, err := strconv.Atoi(argcStr)
+            if !isIdent(name) || err != nil || argc < 0 || argc > 255 {
+                return fail("bad method declaration")
+            }
+            m = &asmMethod{line: lineNo, name: name, entry: name, argc: argc, labels: map[string]int{}}
+            if cls != nil {
+                m.entry = cls.name + "." + name
+                cls.methods = append(cls.methods, m)
+            }
+            a.methods = append(a.methods, m)
+        case ".class":
+            name, ancestor := splitWord(rest)
+            if !isIdent(name) || (ancestor != "" && !isIdent(ancestor)) {
+                return fail("bad class declaration")
+            }
+            cls = &asmClass{line: lineNo, name: name, ancestor: ancestor}
+            a.classes = append(a.classes, cls)
+            m = nil
+        case ".field":
+            if cls == nil {
+                return fail("field outside class")
+            }
+            if !isIdent(rest) {
+                return fail("bad field name %q", rest)
+            }
+            cls.fields = append(cls.fields, rest)
+        case ".end":
+            if cls == nil {
+                return fail("end outside class")
+            }
+            cls, m = nil, nil
+        case ".package":
+            if a.pkg != "" {
+                return fail("duplicate package declaration")
+            }
+            if !isIdent(rest) {
+                return fail("bad package path %q", rest)
+            }
+            a.pkg = rest
+        case ".import":
+            name, path := splitWord(rest)
+            if !isIdent(name) || !isIdent(path) {
+                return fail("bad import")
+            }
+            a.imports = append(a.imports, asmImport{lineNo, name, path})
+        case ".export":
+            if !isIdent(rest) {
+                return fail("bad export %q", rest)
+            }
+            a.exports = append(a.exports, asmExport{lineNo, rest})
+        default:
+            op, ok := opcodeNames[strings.ToUpper(word)]
+            if !ok || op == RESUME {
+                return fail("unknown instruction %s", word)
+            }
+            if m == nil {
+                return fail("instruction outside method")
+            }
+            if (opcodes[op].operand == 0) != (rest == "") {
+                return fail("wrong number of operands for %s", opcodes[op].name)
+            }
+            m.instrs = append(m.instrs, asmInstr{lineNo, op, rest})
+        }
+    }
+    return nil
+}
+
+func (a *assembler) emit() error {
+    // Atoms and names go first so that everything else can refer to them, and
+    // then the package declaration and imports.
+    if a.pkg != "" {
+        a.writer.Compound(PackageType, a.name(a.pkg))
+    }
+    for _, im := range a.imports {
+        if _, ok := a.importIds[im.name]; ok {
+            return &AsmError{im.line, fmt.Sprintf("duplicate import %s", im.name)}
+        }
+        a.importIds[im.name] = a.writer.Compound(ImportType, a.name(im.path))
+    }
+    for _, c := range a.classes {
+        a.name(c.name)
+        for _, f := range c.fields {
+            a.name(f)
+        }
+    }
+    for _, m := range a.methods {
+        a.name(m.name)
+        for _, in := range m.instrs {
+            switch in.op {
+            case GLOBAL:
+                if value, ok := parseLiteral(in.arg); ok {
+                    a.atom(value)
+                } else if c, ok := a.consts[in.arg]; ok {
+                    a.atom(c.value)
+                }
+            case LOOKUP:
+                name, ok := parseName(in.arg)
+                if !ok {
+                    return &AsmError{in.line, fmt.Sprintf("bad name %q", in.arg)}
+                }
+                a.name(name)
+            }
+        }
+    }
+    var object bytecode.ItemId
+    for _, c := range a.classes {
+        if c.ancestor == "" {
+            object = a.writer.Compound(ObjectType)
+            break
+        }
+    }
+    // Each method takes three items, then each field one and each class one.
+    next := bytecode.ItemId(a.writer.Len())
+    for _, m := range a.methods {
+        if _, ok := a.entries[m.entry]; ok {
+            return &AsmError{m.line, fmt.Sprintf("duplicate definition of %s", m.entry)}
+        }
+        m.id = next + 2
+        next += 3
+        a.entries[m.entry] = int(m.id)
+    }
+    classes := map[string]*asmClass{}
+    for _, c := range a.classes {
+        next += bytecode.ItemId(len(c.fields))
+    }
+    for _, c := range a.classes {
+        if _, ok := a.entries[c.name]; ok {
+            return &AsmError{c.line, fmt.Sprintf("duplicate definition of %s", c.name)}
+        }
+        c.id = next
+        next++
+        a.entries[c.name] = int(c.id)
+        classes[c.name] = c
+    }
+    for _, m := range a.methods {
+        code, err := a.assemble(m)
+        if err != nil {
+            return err
+        }
+        codeId := a.writer.Bytes(code)
+        argcId := a.writer.Int(int64(m.argc))
+        a.writer.Compound(MethodType, a.names[m.name], codeId, argcId)
+    }
+    fields := map[*asmClass][]bytecode.ItemId{}
+    for _, c := range a.classes {
+        for _, f := range c.fields {
+            fields[c] = append(fields[c], a.writer.Compound(FieldType, a.names[f]))
+        }
+    }
+    for _, c := range a.classes {
+        ancestor := object
+        if c.ancestor != "" {
+            base, ok := classes[c.ancestor]
+            if !ok || base.id >= c.id {
+                return &AsmError{c.line, fmt.Sprintf("%s must be a class defined earlier", c.ancestor)}
+            }
+            ancestor = base.id
+        }
+        items := []bytecode.ItemId{a.names[c.name], ancestor}
+        for _, m := range c.methods {
+            items = append(items, m.id)
+        }
+        items = append(items, fields[c]...)
+        a.writer.Compound(ClassType, items...)
+    }
+    for _, e := range a.exports {
+        var value bytecode.ItemId
+        if c, ok := a.consts[e.name]; ok {
+            value = a.atom(c.value)
+        } else if id, ok := a.entries[e.name]; ok {
+            value = bytecode.ItemId(id)
+        } else if id, ok := a.importIds[e.name]; ok {
+            value = id
+        } else {
+            return &AsmError{e.line, fmt.Sprintf("cannot export undefined %s", e.name)}
+        }
+        a.writer.Compound(ExportType, a.name(e.name), value)
+    }
+    return a.writer.Err()
+}
+
+func (a *assembler) atom(value interface{}) bytecode.ItemId {
+    if id, ok := a.atoms[value]; ok {
+        return id
+    }
+    var id bytecode.ItemId
+    switch x := value.(type) {
+    case int64:
+        id = a.writer.Int(x)
+    case float64:
+        id = a.writer.Float(x)
+    case string:
+        id = a.writer.Bytes([]byte(x))
+    }
+    a.atoms[value] = id
+    return id
+}
+
+func (a *assembler) name(str string) bytecode.ItemId {
+    if id, ok := a.names[str]; ok {
+        return id
+    }
+    id := a.writer.Compound(NameType, a.atom(str))
+    a.names[str] = id
+    return id
+}
+
+func (a *assembler) assemble(m *asmMethod) (Code, error) {
+    var code Code
+    offsets := make([]int, len(m.instrs)+1)
+    for i, in := range m.instrs {
+        offsets[i] = len(code)
+        code = append(code, byte(in.op))
+        code = append(code, make([]byte, opcodes[in.op].operand)...)
+    }
+    offsets[len(m.instrs)] = len(code)
+    for i, in := range m.instrs {
+        x, err := a.operand(m, in, offsets)
+        if err != nil {
+            return nil, err
+        }
+        size := opcodes[in.op].operand
+        if x < 0 || x >= 1 << (8*uint(size)) {
+            return nil, &AsmError{in.line, fmt.Sprintf("operand %d out of range", x)}
+        }
+        for j := 0; j < size; j++ {
+            code[offsets[i]+1+j] = byte(x >> (8*uint(j)))
+        }
+    }
+    return code, nil
+}
+
+func (a *assembler) operand(m *asmMethod, in asmInstr, offsets []int) (int, error) {
+    fail := func(format string, args ...interface{}) (int, error) {
+        return 0, &AsmError{in.line, fmt.Sprintf(format, args...)}
+    }
+    switch in.op {
+    case HALT, THIS, PUSH, GET, SET, TGET, RETURN, THROW, HANDLE, LOAD, STORE:
+        return 0, nil
+    case JUMP, BRANCH, FRAME:
+        if idx, ok := m.labels[in.arg]; ok {
+            return offsets[idx], nil
+        }
+        if n, err := strconv.Atoi(in.arg); err == nil {
+            return n, nil
+        }
+        return fail("undefined label %s", in.arg)
+    case GLOBAL:
+        if value, ok := parseLiteral(in.arg); ok {
+            return int(a.atoms[value]), nil
+        }
+        if c, ok := a.consts[in.arg]; ok {
+            return int(a.atoms[c.value]), nil
+        }
+        if id, ok := a.importIds[in.arg]; ok {
+            return int(id), nil
+        }
+        if id, ok := a.entries[in.arg]; ok {
+            return id, nil
+        }
+        return fail("undefined constant %s", in.arg)
+    case LOOKUP:
+        name, _ := parseName(in.arg)
+        return int(a.names[name]), nil
+    }
+    n, err := strconv.Atoi(in.arg)
+    if err != nil {
+        return fail("bad operand %q", in.arg)
+    }
+    return n, nil
+}
+
+func stripComment(line string) string {
+    quoted := false
+    for i := 0; i < len(line); i++ {
+        switch line[i] {
+        case '\\':
+            if quoted {
+                i++
+            }
+        case '"':
+            quoted = !quoted
+        case ';':
+            if !quoted {
+                return line[:i]
+            }
+        }
+    }
+    return line
+}
+
+func splitWord(s string) (string, string) {
+    i := strings.IndexAny(s, " \t")
+    if i == -1 {
+        return s, ""
+    }
+    return s[:i], strings.TrimSpace(s[i:])
+}
+
+func isIdent(s string) bool {
+    if s == "" {
+        return false
+    }
+    for i, c := range s {
+        letter := c == '_' || c == '.' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+        if !letter && (i == 0 || c < '0' || c > '9') {
+            return false
+        }
+    }
+    return true
+}
+
+func parseLiteral(s string) (interface{}, bool) {
+    if strings.HasPrefix(s, "\"") {
+        str, err := strconv.Unquote(s)
+        return str, err == nil
+    }
+    if n, err := strconv.ParseInt(s, 0, 64); err == nil {
+        return n, true
+    }
+    if f, err := strconv.ParseFloat(s, 64); err == nil && !isIdent(s) {
+        return f, true
+    }
+    return nil, false
+}
+
+func parseName(s string) (string, bool) {
+    if strings.HasPrefix(s, "\"") {
+        str, err := strconv.Unquote(s)
+        return str, err == nil
+    }
+    return s, isIdent(s)
+}
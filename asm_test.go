@@ -0,0 +1,134 @@
+package script
+
+import (
+    "testing"
+)
+
+func assembleUnit(t *testing.T, host *Interpreter, src string) (*Unit, *Assembly) {
+    a, err := Assemble(src)
+    if err != nil {
+        t.Fatal(err)
+    }
+    u, err := host.LoadAssembly(a)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return u, a
+}
+
+func TestAssemble(t *testing.T) {
+    host := New()
+    u, a := assembleUnit(t, host, `
+        .const greeting "hello" ; a comment
+        .const semi "a;b"
+
+        .method main 0
+            GLOBAL handler
+            HANDLE
+            GLOBAL greeting
+            THROW
+            RETURN
+
+        .method handler 1
+            BOUND 0
+            RETURN
+
+        .method jumps 0
+            JUMP skip
+            GLOBAL 1
+            RETURN
+        skip:
+            GLOBAL semi
+            RETURN
+
+        .class Pair
+        .field first
+        .method second 2
+            BOUND 1
+            RETURN
+        .end
+    `)
+    for i, test := range ([]struct{entry string; result V}{
+        {"main", String("hello")},
+        {"jumps", String("a;b")},
+        {"Pair.second", Int(2)},
+    }) {
+        entry, ok := a.Entry(test.entry)
+        if !ok {
+            t.Errorf("[%d]: missing entry %s", i, test.entry)
+            continue
+        }
+        var args []V
+        if test.entry == "Pair.second" {
+            args = []V{Int(1), Int(2)}
+        }
+        result, err := host.Run(u, entry, V{}, args...)
+        if err != nil {
+            t.Errorf("[%d]: unexpected error %v", i, err)
+        }
+        if result != test.result {
+            t.Errorf("[%d]: %#v != %#v", i, result, test.result)
+        }
+    }
+    entry, _ := a.Entry("Pair")
+    cls, ok := u.Values[entry].val.(*class)
+    if !ok {
+        t.Fatalf("expected class, got %#v", u.Values[entry])
+    }
+    if cls.name.str != "Pair" || testName(cls, "first") == nil || testName(cls, "second") == nil {
+        t.Errorf("unexpected class %s", DisassembleUnit(u))
+    }
+}
+
+func TestAssembleCode(t *testing.T) {
+    u, a := assembleUnit(t, New(), `
+        .method main 0
+            FRAME done
+            GLOBAL 1
+            PUSH
+            GLOBAL 1.5
+            LOOKUP "odd name"
+            CALL 1
+        done:
+            RETURN
+    `)
+    entry, _ := a.Entry("main")
+    expected := `0000  FRAME    21
+0003  GLOBAL   2	; 1
+0008  PUSH
+0009  GLOBAL   3	; 1.5
+0014  LOOKUP   5	; name odd name
+0019  CALL     1
+0021  RETURN
+`
+    if s := Disassemble(u.Values[entry].val.(*method).code, u); s != expected {
+        t.Errorf("unexpected listing:\n%s", s)
+    }
+}
+
+func TestAssembleErrors(t *testing.T) {
+    for i, test := range ([]struct{src string; line int}{
+        {"PUSH", 1},
+        {".method main 0\n  FOO", 2},
+        {".method main 0\n  PUSH 1", 2},
+        {".method main 0\n  BOUND", 2},
+        {".method main 0\n  JUMP nowhere", 2},
+        {".method main 0\n  GLOBAL nothing", 2},
+        {".method main 0\n  BOUND 256", 2},
+        {".method main 0\nx:\nx:", 3},
+        {".method main 0\n.method main 1", 2},
+        {".field x", 1},
+        {".class A B\n.end", 1},
+        {".const x", 1},
+    }) {
+        _, err := Assemble(test.src)
+        aerr, ok := err.(*AsmError)
+        if !ok {
+            t.Errorf("[%d]: expected an assembly error, got %v", i, err)
+            continue
+        }
+        if aerr.Line != test.line {
+            t.Errorf("[%d]: wrong line: %v", i, aerr)
+        }
+    }
+}
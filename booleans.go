@@ -0,0 +1,34 @@
+package script
+
+import ()
+
+// True and false are the instances of Boolean, and nil is the instance of Nil.
+// Only false and nil count as false when branching.
+func (e *Interpreter) initBooleans() {
+    cs := e.builtins.classes
+    e.defineBuiltins(cs.Boolean, []builtinMember{
+        {"not", func(x bool) bool { return !x }},
+        {"and", func(x bool, y V) bool { return x && y.AsBool() }},
+        {"or", func(x bool, y V) bool { return x || y.AsBool() }},
+        {"eq", func(x bool, y V) bool { return sameBool(x, y) }},
+        {"ne", func(x bool, y V) bool { return !sameBool(x, y) }},
+        {"toString", func(x bool) string {
+            if x {
+                return "true"
+            }
+            return "false"
+        }},
+    })
+    e.defineBuiltins(cs.Nil, []builtinMember{
+        {"isNil", func(x V) bool { return true }},
+        {"not", func(x V) bool { return true }},
+        {"eq", func(x, y V) bool { return y.IsNil() }},
+        {"ne", func(x, y V) bool { return !y.IsNil() }},
+        {"toString", func(x V) string { return "nil" }},
+    })
+}
+
+func sameBool(x bool, y V) bool {
+    b, ok := y.val.(bool)
+    return ok && b == x
+}
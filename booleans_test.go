@@ -0,0 +1,85 @@
+package script
+
+import (
+    "testing"
+)
+
+func TestBooleans(t *testing.T) {
+    host := New()
+    for i, test := range ([]struct{recv V; name string; args []V; result V}{
+        {True(), "not", nil, False()},
+        {True(), "and", []V{Nil()}, False()},
+        {False(), "or", []V{Int(0)}, True()},
+        {True(), "eq", []V{True()}, True()},
+        {True(), "eq", []V{Int(1)}, False()},
+        {False(), "ne", []V{True()}, True()},
+        {False(), "toString", nil, String("false")},
+        {Nil(), "isNil", nil, True()},
+        {Nil(), "not", nil, True()},
+        {Nil(), "eq", []V{Nil()}, True()},
+        {Nil(), "ne", []V{False()}, True()},
+        {Nil(), "toString", nil, String("nil")},
+    }) {
+        result, err := host.Run(sendUnit(test.recv, host.Intern(test.name), test.args...), 0, V{})
+        if err != nil {
+            t.Errorf("[%d]: unexpected error %v", i, err)
+        }
+        if result != test.result {
+            t.Errorf("[%d]: %#v != %#v", i, result, test.result)
+        }
+    }
+}
+
+func TestTruthiness(t *testing.T) {
+    host := New()
+    u, a := assembleUnit(t, host, `
+        .class Box
+        .field x
+        .end
+
+        .method truthy 1
+            BOUND 0
+            BRANCH no
+            GLOBAL "yes"
+            RETURN
+        no:
+            GLOBAL "no"
+            RETURN
+
+        .method assign 1
+            GLOBAL 5
+            PUSH
+            BOUND 0
+            LOOKUP x
+            SET
+            LOOKUP isNil
+            TCALL 0
+    `)
+    truthy, _ := a.Entry("truthy")
+    for i, test := range ([]struct{x V; result string}{
+        {Nil(), "no"},
+        {False(), "no"},
+        {True(), "yes"},
+        {Int(0), "yes"},
+        {String(""), "yes"},
+        {Array(), "yes"},
+    }) {
+        result, err := host.Run(u, truthy, V{}, test.x)
+        if err != nil {
+            t.Errorf("[%d]: unexpected error %v", i, err)
+        }
+        if result != String(test.result) {
+            t.Errorf("[%d]: %#v != %s", i, result, test.result)
+        }
+    }
+    box, _ := a.Entry("Box")
+    obj, _ := host.New(u.Values[box])
+    assign, _ := a.Entry("assign")
+    result, err := host.Run(u, assign, V{}, obj)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if result != True() {
+        t.Errorf("assignment gave %#v", result)
+    }
+}
@@ -5,8 +5,6 @@ import (
     "errors"
     "math"
     "encoding/binary"
-    
-    "fmt"
 )
 
 type ItemId uint32
@@ -25,10 +23,17 @@ type Handler interface {
     Float(x float64) error
     Bytes(bs []byte) error
     // Compound items
-    CompoundSize(id TypeId) (int, error)
+    Layout
     Compound(id TypeId, items []ItemId) error
 }
 
+// Compound items are identified by a TypeId. The layout says how many items
+// each type refers to. A negative size means that the number of items varies
+// and is stored in the image alongside the items themselves.
+type Layout interface {
+    CompoundSize(id TypeId) (int, error)
+}
+
 
 const (
     magicString = "\x00SCR"
@@ -171,7 +176,7 @@ func (r *reader) readFloat() {
     bits := binary.LittleEndian.Uint64(r.buf)
     r.buf = r.buf[8:]
     f := math.Float64frombits(bits)
-    r.handler.Float(f)
+    r.err = r.handler.Float(f)
 }
 
 func (r *reader) readSize() (uint32, bool) {
@@ -198,7 +203,6 @@ func (r *reader) readBytes() {
 func (r *reader) readCompound(idb byte) {
     id := TypeId(idb)
     size := r.readCompoundSize(id)
-    fmt.Println(size, r.err)
     if r.err != nil {
         return
     }
@@ -208,13 +212,14 @@ func (r *reader) readCompound(idb byte) {
     items := make([]ItemId, size)
     for i := range items {
         items[i] = ItemId(binary.LittleEndian.Uint32(r.buf[4*i:]))
-        if items[i] > r.lastItem {
+        // Items can only refer to those that came before them.
+        if items[i] >= r.lastItem {
             r.err = ErrInvalidEntry
             return
         }
     }
     r.buf = r.buf[4*size:]
-    r.handler.Compound(id, items)
+    r.err = r.handler.Compound(id, items)
 }
 
 func (r *reader) readCompoundSize(id TypeId) int {
@@ -68,6 +68,7 @@ func TestRead(t *testing.T) {
         {header + "\x07\x00\x00\x00\x00\x00\x03\x00\x00\x00\x00", nil, []testItem{{"int", int64(0)}, {"test1", []ItemId{0}}}},
         {header + "\x01\x00\x00\x00\x04", nil, []testItem{{"test2", []ItemId{}}}},
         {header + "\x05\x00\x00\x00\x05\x00\x00\x00\x00", nil, []testItem{{"test3", []ItemId{}}}},
+        {header + "\x05\x00\x00\x00\x03\x00\x00\x00\x00", ErrInvalidEntry, nil},
     }) {
         handler := &testHandler{}
         err := ReadImage(strings.NewReader(test.inp), handler)
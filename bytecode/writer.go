@@ -0,0 +1,118 @@
+package bytecode
+
+import (
+    "io"
+    "math"
+    "encoding/binary"
+)
+
+// Builds a bytecode image that can be read back with ReadImage.
+//
+// Each method adds an item to the image and returns the ItemId it was given,
+// so that later compound items can refer to it. Errors are sticky: once an
+// item has been rejected the rest are ignored and the error is reported by
+// Err and WriteTo.
+type Writer struct {
+    layout Layout
+    buf []byte
+    count ItemId
+    err error
+}
+
+func NewWriter(layout Layout) *Writer {
+    return &Writer{layout: layout}
+}
+
+func (w *Writer) Int(x int64) ItemId {
+    if w.err != nil {
+        return 0
+    }
+    w.buf = append(w.buf, Int)
+    w.buf = binary.AppendVarint(w.buf, x)
+    return w.nextItem()
+}
+
+func (w *Writer) Float(x float64) ItemId {
+    if w.err != nil {
+        return 0
+    }
+    w.buf = append(w.buf, Float)
+    w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(x))
+    return w.nextItem()
+}
+
+func (w *Writer) Bytes(bs []byte) ItemId {
+    if w.err != nil {
+        return 0
+    }
+    w.buf = append(w.buf, Bytes)
+    w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(len(bs)))
+    w.buf = append(w.buf, bs...)
+    return w.nextItem()
+}
+
+func (w *Writer) Compound(id TypeId, items ...ItemId) ItemId {
+    if w.err != nil {
+        return 0
+    }
+    if id <= Bytes {
+        w.err = ErrUnknownSection
+        return 0
+    }
+    size, err := w.layout.CompoundSize(id)
+    if err != nil {
+        w.err = err
+        return 0
+    }
+    if size >= 0 && size != len(items) {
+        w.err = ErrInvalidEntry
+        return 0
+    }
+    for _, item := range items {
+        if item >= w.count {
+            w.err = ErrInvalidEntry
+            return 0
+        }
+    }
+    w.buf = append(w.buf, byte(id))
+    if size < 0 {
+        w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(len(items)))
+    }
+    for _, item := range items {
+        w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(item))
+    }
+    return w.nextItem()
+}
+
+func (w *Writer) nextItem() ItemId {
+    id := w.count
+    w.count++
+    return id
+}
+
+// The number of items written so far. This is also the ItemId that the next
+// item will be given.
+func (w *Writer) Len() int {
+    return int(w.count)
+}
+
+func (w *Writer) Err() error {
+    return w.err
+}
+
+// Write the image, including its header, to out.
+func (w *Writer) WriteTo(out io.Writer) (int64, error) {
+    if w.err != nil {
+        return 0, w.err
+    }
+    head := make([]byte, 0, 12)
+    head = append(head, magicString...)
+    head = append(head, formatString...)
+    head = binary.LittleEndian.AppendUint32(head, uint32(len(w.buf)))
+    n, err := out.Write(head)
+    if err != nil {
+        return int64(n), err
+    }
+    m, err := out.Write(w.buf)
+    return int64(n + m), err
+}
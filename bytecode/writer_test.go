@@ -0,0 +1,104 @@
+package bytecode
+
+import (
+    "testing"
+    "bytes"
+    "reflect"
+)
+
+func TestWrite(t *testing.T) {
+    header := "\x00SCR\x01\x00\x00\x00"
+    for i, test := range ([]struct{write func(w *Writer); out string}{
+        {func(w *Writer) {}, header + "\x00\x00\x00\x00"},
+        {func(w *Writer) {
+            w.Int(0)
+        }, header + "\x02\x00\x00\x00\x00\x00"},
+        {func(w *Writer) {
+            w.Float(0)
+        }, header + "\x09\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00"},
+        {func(w *Writer) {
+            w.Bytes([]byte{1,2,3,4})
+        }, header + "\x09\x00\x00\x00\x02\x04\x00\x00\x00\x01\x02\x03\x04"},
+        {func(w *Writer) {
+            w.Compound(3, w.Int(0))
+        }, header + "\x07\x00\x00\x00\x00\x00\x03\x00\x00\x00\x00"},
+        {func(w *Writer) {
+            w.Compound(4)
+        }, header + "\x01\x00\x00\x00\x04"},
+        {func(w *Writer) {
+            w.Compound(5)
+        }, header + "\x05\x00\x00\x00\x05\x00\x00\x00\x00"},
+    }) {
+        w := NewWriter(&testHandler{})
+        test.write(w)
+        buf := new(bytes.Buffer)
+        n, err := w.WriteTo(buf)
+        if err != nil {
+            t.Errorf("[%d] unexpected error: %s", i, err)
+        }
+        if n != int64(buf.Len()) {
+            t.Errorf("[%d] wrong length reported: %d != %d", i, n, buf.Len())
+        }
+        if buf.String() != test.out {
+            t.Errorf("[%d] unexpected output (expected: %q, got: %q)", i, test.out, buf.String())
+        }
+    }
+}
+
+func TestWriteErrors(t *testing.T) {
+    for i, test := range ([]struct{write func(w *Writer); err error}{
+        {func(w *Writer) {
+            w.Compound(Bytes)
+        }, ErrUnknownSection},
+        {func(w *Writer) {
+            w.Compound(9)
+        }, ErrUnknownSection},
+        {func(w *Writer) {
+            w.Compound(3)
+        }, ErrInvalidEntry},
+        {func(w *Writer) {
+            w.Compound(5, 0)
+        }, ErrInvalidEntry},
+        {func(w *Writer) {
+            w.Compound(5, w.Int(1), 1)
+        }, ErrInvalidEntry},
+    }) {
+        w := NewWriter(&testHandler{})
+        test.write(w)
+        if w.Err() != test.err {
+            t.Errorf("[%d] unexpected error (expected: %s, got: %s)", i, test.err, w.Err())
+        }
+        if _, err := w.WriteTo(new(bytes.Buffer)); err != test.err {
+            t.Errorf("[%d] WriteTo did not report error: %s", i, err)
+        }
+    }
+}
+
+func TestRoundTrip(t *testing.T) {
+    w := NewWriter(&testHandler{})
+    a := w.Int(-300)
+    b := w.Float(2.5)
+    c := w.Bytes([]byte("hello"))
+    d := w.Compound(3, c)
+    w.Compound(5, a, b, d)
+    w.Compound(4)
+    buf := new(bytes.Buffer)
+    if _, err := w.WriteTo(buf); err != nil {
+        t.Fatal(err)
+    }
+    handler := &testHandler{}
+    if err := ReadImage(buf, handler); err != nil {
+        t.Fatal(err)
+    }
+    expected := []testItem{
+        {"int", int64(-300)},
+        {"float", 2.5},
+        {"bytes", []byte("hello")},
+        {"test1", []ItemId{2}},
+        {"test3", []ItemId{0, 1, 3}},
+        {"test2", []ItemId{}},
+    }
+    if !reflect.DeepEqual(handler.items, expected) {
+        t.Errorf("unexpected items (expected: %#v, got: %#v)", expected, handler.items)
+    }
+}
@@ -0,0 +1,138 @@
+package script
+
+import (
+    "sort"
+    "sync/atomic"
+    "unsafe"
+)
+
+// Each LOOKUP instruction remembers where it found its name in the shapes of
+// the receivers it has seen, so that looking the name up again in one of those
+// shapes skips the search. A site remembers a few shapes and then stops adding
+// new ones.
+const maxSiteShapes = 4
+
+type lookupSite struct {
+    __entries *[]siteEntry
+}
+
+type siteEntry struct {
+    shape entityId
+    offset int
+}
+
+// Counts of how often LOOKUP instructions have found their name in the cache.
+// Processes keep their own counts and add them to these when they stop
+// running, so that lookups do not contend for the counters.
+type CacheStats struct {
+    Hits, Misses uint64
+}
+
+func (host *Interpreter) CacheStats() CacheStats {
+    return CacheStats{
+        atomic.LoadUint64(&host.cacheHits),
+        atomic.LoadUint64(&host.cacheMisses),
+    }
+}
+
+func (p *Process) flushCacheStats() {
+    if p.cacheHits != 0 {
+        atomic.AddUint64(&p.host.cacheHits, p.cacheHits)
+        p.cacheHits = 0
+    }
+    if p.cacheMisses != 0 {
+        atomic.AddUint64(&p.host.cacheMisses, p.cacheMisses)
+        p.cacheMisses = 0
+    }
+}
+
+// Give each LOOKUP instruction a site. Decoding stops at an invalid opcode, and
+// any LOOKUPs after it go without a cache.
+func (m *method) findSites() {
+    for pos := 0; pos < len(m.code); {
+        op := int(m.code[pos])
+        if op >= len(opcodes) {
+            break
+        }
+        if op == LOOKUP {
+            m.sitePos = append(m.sitePos, pos)
+        }
+        pos += 1 + opcodes[op].operand
+    }
+    m.sites = make([]lookupSite, len(m.sitePos))
+}
+
+// The site for the LOOKUP instruction at pos, or nil if it does not have one.
+func (m *method) site(pos int) *lookupSite {
+    i := sort.SearchInts(m.sitePos, pos)
+    if i == len(m.sitePos) || m.sitePos[i] != pos {
+        return nil
+    }
+    return &m.sites[i]
+}
+
+func (s *lookupSite) getEntriesLoc() *unsafe.Pointer {
+    return (*unsafe.Pointer)(unsafe.Pointer(&s.__entries))
+}
+
+func (s *lookupSite) getEntries() []siteEntry {
+    p := atomic.LoadPointer(s.getEntriesLoc())
+    if p == nil {
+        return nil
+    }
+    return *(*[]siteEntry)(p)
+}
+
+func (s *lookupSite) find(shape entityId) int {
+    for _, e := range s.getEntries() {
+        if e.shape == shape {
+            return e.offset
+        }
+    }
+    return -1
+}
+
+// Sites are updated without locking, so an entry may occasionally be lost when
+// two processes add to the same site at once. It will be added again later.
+func (s *lookupSite) add(x siteEntry) {
+    old := s.getEntries()
+    if len(old) >= maxSiteShapes {
+        return
+    }
+    entries := make([]siteEntry, len(old)+1)
+    copy(entries, old)
+    entries[len(old)] = x
+    atomic.StorePointer(s.getEntriesLoc(), unsafe.Pointer(&entries))
+}
+
+// Look up a name for the LOOKUP instruction at site. Only names found directly
+// in the receiver's class are cached; anything else goes through lookup.
+func (p *Process) cachedLookup(site int, nm V) {
+    n, nameOk := nm.val.(*Name)
+    cls, classOk := p.host.ClassOf(p.result).val.(*class)
+    if !nameOk || !classOk || p.method == nil || !p.canSee(n) {
+        p.lookup(nm)
+        return
+    }
+    s := p.method.site(site)
+    if s == nil {
+        p.lookup(nm)
+        return
+    }
+    ms := cls.getMembers()
+    shape := ms.shape
+    offset := s.find(shape.id)
+    if offset != -1 {
+        p.cacheHits++
+        p.slot = ms.values[offset]
+        return
+    }
+    p.cacheMisses++
+    offset = shape.lookup(n)
+    if offset == -1 {
+        p.lookup(nm)
+        return
+    }
+    s.add(siteEntry{shape.id, offset})
+    p.slot = ms.values[offset]
+}
@@ -0,0 +1,64 @@
+package script
+
+import (
+    "testing"
+)
+
+func TestLookupCache(t *testing.T) {
+    host := New()
+    object := host.builtins.classes.Object.val.(*class)
+    name := new(Name).init("value")
+    constant := func(x V) V {
+        return V{Primitive(func(p *Process) Action {
+            return Return(x)
+        })}
+    }
+    var objects []V
+    for i := 0; i < 6; i++ {
+        // The first two classes share a shape.
+        names := []*Name{name}
+        if i > 1 {
+            names = append(names, new(Name).init("other"))
+        }
+        values := make([]V, len(names))
+        values[0] = constant(Int(int64(i)))
+        cls := newClass(new(Name).init("Test"), object, names, values)
+        objects = append(objects, V{&UserObject{V{cls}, nil}})
+    }
+    if objects[0].val.(*UserObject).class.val.(*class).getMembers().shape != objects[1].val.(*UserObject).class.val.(*class).getMembers().shape {
+        t.Fatal("expected a shared shape")
+    }
+    u := sendUnit(V{}, name)
+    if m := u.Values[0].val.(*method); len(m.sites) != 1 || m.sitePos[0] != 8 {
+        t.Errorf("unexpected sites at %v", m.sitePos)
+    }
+    for i, test := range ([]struct{recv int; stats CacheStats}{
+        {0, CacheStats{0, 1}},
+        {0, CacheStats{1, 1}},
+        {1, CacheStats{2, 1}},
+        {2, CacheStats{2, 2}},
+        {2, CacheStats{3, 2}},
+        {3, CacheStats{3, 3}},
+        {4, CacheStats{3, 4}},
+        {5, CacheStats{3, 5}},
+        {5, CacheStats{3, 6}},
+        {4, CacheStats{4, 6}},
+    }) {
+        u.Values[1] = objects[test.recv]
+        result, err := host.Run(u, 0, V{})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if result != Int(int64(test.recv)) {
+            t.Errorf("[%d]: %#v != %d", i, result, test.recv)
+        }
+        if stats := host.CacheStats(); stats != test.stats {
+            t.Errorf("[%d]: unexpected stats %+v", i, stats)
+        }
+    }
+    objects[0].val.(*UserObject).class.val.(*class).define(name, constant(String("new")))
+    u.Values[1] = objects[0]
+    if result, _ := host.Run(u, 0, V{}); result != String("new") {
+        t.Errorf("redefined member not seen: %#v", result)
+    }
+}
@@ -0,0 +1,448 @@
+package script
+
+import (
+    "errors"
+    "sort"
+    "sync"
+    "sync/atomic"
+)
+
+var ErrChannelClosed = errors.New("channel is closed")
+
+// A Channel passes values between threads, and between threads and the host.
+// Sending waits until a receiver takes the value or, if the channel has a
+// buffer, until there is space in it. Receiving waits until there is a value.
+// Threads that wait are parked until another thread or the host completes
+// their operation, while host goroutines block.
+//
+// Scripts make channels with thread.Channel.new(capacity), where the capacity
+// is zero if left out, and use them with these members:
+//
+//     ch.send(x)        send x, throwing if the channel is closed
+//     ch.receive()      receive a value, or nil once the channel is closed
+//                       and empty
+//     ch.receiveOk()    receive [x, ok], where ok is false rather than x
+//                       being a value once the channel is closed and empty
+//     ch.close()        close the channel, waking everything waiting on it
+//     ch.closed()       whether the channel is closed
+//     ch.length()       the number of buffered values
+//     ch.capacity()     the size of the buffer
+//
+// thread.select(cases...) waits until one of the cases can go ahead, does it
+// and returns [i, x, ok], where i is the index of the case, x the value it
+// received, if any, and ok is as for receiveOk. A case of [ch] receives from ch
+// and [ch, x] sends x on it.
+// Earlier cases win when several are ready. thread.trySelect(cases...) is the
+// same but returns nil rather than waiting.
+type Channel struct {
+    id uint64
+    lock sync.Mutex
+    capacity int
+    buf []V
+    closed bool
+    // Set once the host may use the channel, at which point threads waiting
+    // on it are not deadlocked.
+    shared bool
+    recvq, sendq []*waiter
+}
+
+var channelIds uint64
+
+func newChannel(capacity int) *Channel {
+    return &Channel{id: atomic.AddUint64(&channelIds, 1), capacity: capacity}
+}
+
+// Create a channel for the host to share with scripts.
+func (host *Interpreter) NewChannel(capacity int) V {
+    c := newChannel(capacity)
+    c.shared = true
+    return V{c}
+}
+
+func (v V) AsChannel() (*Channel, bool) {
+    c, ok := v.val.(*Channel)
+    return c, ok
+}
+
+// Tell the scheduler that the host may use a channel that a script made.
+// Until then, threads that wait only on the channel are taken to be
+// deadlocked once nothing else can run. Channels from NewChannel are already
+// shared.
+func (c *Channel) Share() {
+    c.lock.Lock()
+    c.shared = true
+    c.lock.Unlock()
+}
+
+// Send x, blocking until it is received or buffered.
+func (c *Channel) Send(x V) error {
+    if r := c.hostSelect(selectCase{c, true, x}); !r.ok {
+        return ErrChannelClosed
+    }
+    return nil
+}
+
+// Receive a value, blocking until there is one. The result is false once the
+// channel is closed and empty.
+func (c *Channel) Receive() (V, bool) {
+    r := c.hostSelect(selectCase{c, false, V{}})
+    return r.value, r.ok
+}
+
+// Close the channel. Waiting receivers get nil, and waiting senders fail.
+// Values already buffered can still be received.
+func (c *Channel) Close() error {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    if c.closed {
+        return ErrChannelClosed
+    }
+    c.closed = true
+    for _, q := range [][]*waiter{c.recvq, c.sendq} {
+        for _, w := range q {
+            if w.claim() {
+                w.complete(V{}, false)
+            }
+        }
+    }
+    c.recvq, c.sendq = nil, nil
+    return nil
+}
+
+func (c *Channel) hostSelect(sc selectCase) selectResult {
+    sel := &selection{reply: make(chan selectResult, 1)}
+    if r, ready := selectCases([]selectCase{sc}, sel); ready {
+        return r
+    }
+    return <-sel.reply
+}
+
+// Waiting on channels is done with a selection, which is either a parked
+// thread or a host goroutine. Each case has a waiter in its channel's queue,
+// and whichever claims the selection first completes it.
+type selection struct {
+    done int32
+    shape resultShape
+    thread *Thread
+    reply chan selectResult
+}
+
+type waiter struct {
+    sel *selection
+    index int
+    send bool
+    value V
+}
+
+type selectCase struct {
+    ch *Channel
+    send bool
+    value V
+}
+
+// The outcome of a case. For senders ok is false if the channel was closed, and
+// for receivers if it was closed with nothing left to receive.
+type selectResult struct {
+    index int
+    value V
+    ok bool
+}
+
+func (w *waiter) claim() bool {
+    return atomic.CompareAndSwapInt32(&w.sel.done, 0, 1)
+}
+
+func (w *waiter) complete(x V, ok bool) {
+    r := selectResult{w.index, x, ok}
+    if w.sel.thread == nil {
+        w.sel.reply <- r
+        return
+    }
+    t := w.sel.thread
+    if w.send && !ok {
+        t.sched.wake(t, errSendClosed, true)
+        return
+    }
+    t.sched.wake(t, selectValue(r, w.sel.shape), false)
+}
+
+// What scripts get back from waiting on channels.
+type resultShape int
+
+const (
+    valueResult resultShape = iota // x
+    okResult                       // [x, ok]
+    caseResult                     // [i, x, ok]
+)
+
+func selectValue(r selectResult, shape resultShape) V {
+    switch shape {
+    case okResult:
+        return Array(r.value, Bool(r.ok))
+    case caseResult:
+        return Array(Int(int64(r.index)), r.value, Bool(r.ok))
+    }
+    return r.value
+}
+
+var errSendClosed = String("send on closed channel")
+
+// Go ahead with the first case that is ready. If none are and sel is not nil,
+// then sel waits on all of them.
+func selectCases(cases []selectCase, sel *selection) (selectResult, bool) {
+    chans := lockChannels(cases)
+    defer func() {
+        for _, c := range chans {
+            c.lock.Unlock()
+        }
+    }()
+    for i, sc := range cases {
+        if sc.send {
+            if ok, ready := sc.ch.pollSend(sc.value); ready {
+                return selectResult{i, V{}, ok}, true
+            }
+        } else if x, ok, ready := sc.ch.pollReceive(); ready {
+            return selectResult{i, x, ok}, true
+        }
+    }
+    if sel == nil {
+        return selectResult{}, false
+    }
+    if sel.thread != nil {
+        for _, c := range chans {
+            if c.shared {
+                sel.thread.sched.waitOnHost(sel.thread)
+                break
+            }
+        }
+    }
+    for i, sc := range cases {
+        w := &waiter{sel, i, sc.send, sc.value}
+        if sc.send {
+            sc.ch.sendq = enqueue(sc.ch.sendq, w)
+        } else {
+            sc.ch.recvq = enqueue(sc.ch.recvq, w)
+        }
+    }
+    return selectResult{}, false
+}
+
+// Channels are locked in order of creation, so that selects over the same
+// channels cannot deadlock.
+func lockChannels(cases []selectCase) []*Channel {
+    var chans []*Channel
+    seen := map[*Channel]bool{}
+    for _, sc := range cases {
+        if !seen[sc.ch] {
+            seen[sc.ch] = true
+            chans = append(chans, sc.ch)
+        }
+    }
+    sort.Slice(chans, func(i, j int) bool {
+        return chans[i].id < chans[j].id
+    })
+    for _, c := range chans {
+        c.lock.Lock()
+    }
+    return chans
+}
+
+// Try to send without waiting.
+func (c *Channel) pollSend(x V) (ok, ready bool) {
+    if c.closed {
+        return false, true
+    }
+    if w := popWaiter(&c.recvq); w != nil {
+        w.complete(x, true)
+        return true, true
+    }
+    if len(c.buf) < c.capacity {
+        c.buf = append(c.buf, x)
+        return true, true
+    }
+    return false, false
+}
+
+// Try to receive without waiting.
+func (c *Channel) pollReceive() (x V, ok, ready bool) {
+    if len(c.buf) != 0 {
+        x = c.buf[0]
+        c.buf[0] = V{}
+        c.buf = c.buf[1:]
+        // A waiting sender takes the space.
+        if w := popWaiter(&c.sendq); w != nil {
+            c.buf = append(c.buf, w.value)
+            w.complete(V{}, true)
+        }
+        return x, true, true
+    }
+    if w := popWaiter(&c.sendq); w != nil {
+        w.complete(V{}, true)
+        return w.value, true, true
+    }
+    if c.closed {
+        return V{}, false, true
+    }
+    return V{}, false, false
+}
+
+// Remove waiters from the front of the queue until one can be claimed.
+func popWaiter(q *[]*waiter) *waiter {
+    for len(*q) != 0 {
+        w := (*q)[0]
+        (*q)[0] = nil
+        *q = (*q)[1:]
+        if w.claim() {
+            return w
+        }
+    }
+    return nil
+}
+
+// Waiters left behind by selects that finished elsewhere are dropped as new
+// ones arrive.
+func enqueue(q []*waiter, w *waiter) []*waiter {
+    live := q[:0]
+    for _, x := range q {
+        if atomic.LoadInt32(&x.sel.done) == 0 {
+            live = append(live, x)
+        }
+    }
+    for i := len(live); i < len(q); i++ {
+        q[i] = nil
+    }
+    return append(live, w)
+}
+
+func (e *Interpreter) initChannels() {
+    cs := &e.builtins.classes
+    cs.Channel = V{newClass(e.Intern("Channel"), cs.Object.val.(*class), nil, nil)}
+    cs.Channel.val.(*class).newFn = makeChannel
+    e.defineBuiltins(cs.Channel, []builtinMember{
+        {"send", sendChannel},
+        {"receive", receiveChannel},
+        {"receiveOk", receiveOkChannel},
+        {"close", func(x V) error { return x.val.(*Channel).Close() }},
+        {"closed", func(x V) bool {
+            c := x.val.(*Channel)
+            c.lock.Lock()
+            defer c.lock.Unlock()
+            return c.closed
+        }},
+        {"length", func(x V) int {
+            c := x.val.(*Channel)
+            c.lock.Lock()
+            defer c.lock.Unlock()
+            return len(c.buf)
+        }},
+        {"capacity", func(x V) int { return x.val.(*Channel).capacity }},
+    })
+}
+
+// Channel.new(capacity) makes a channel.
+func makeChannel(p *Process) Action {
+    args := p.Args()
+    if len(args) > 1 {
+        return Throw(String("wrong number of arguments"))
+    }
+    var capacity int64
+    if len(args) == 1 {
+        n, ok := args[0].AsInt()
+        if !ok || n < 0 {
+            return Throw(String("capacity must be a non-negative Integer"))
+        }
+        capacity = n
+    }
+    return Return(V{newChannel(int(capacity))})
+}
+
+func sendChannel(p *Process) Action {
+    args := p.Args()
+    if len(args) != 1 {
+        return Throw(String("wrong number of arguments"))
+    }
+    return p.waitOn([]selectCase{{p.Receiver().val.(*Channel), true, args[0]}}, valueResult)
+}
+
+func receiveChannel(p *Process) Action {
+    return receiveAs(p, valueResult)
+}
+
+func receiveOkChannel(p *Process) Action {
+    return receiveAs(p, okResult)
+}
+
+func receiveAs(p *Process, shape resultShape) Action {
+    if len(p.Args()) != 0 {
+        return Throw(String("wrong number of arguments"))
+    }
+    return p.waitOn([]selectCase{{p.Receiver().val.(*Channel), false, V{}}}, shape)
+}
+
+func selectChannels(p *Process) Action {
+    cases, err := selectArgs(p.Args())
+    if err != nil {
+        return Throw(String(err.Error()))
+    }
+    return p.waitOn(cases, caseResult)
+}
+
+func trySelectChannels(p *Process) Action {
+    cases, err := selectArgs(p.Args())
+    if err != nil {
+        return Throw(String(err.Error()))
+    }
+    r, ready := selectCases(cases, nil)
+    if !ready {
+        return Return(Nil())
+    }
+    return selectAction(cases[r.index], r, caseResult)
+}
+
+var errSelectCase = errors.New("cases must be [channel] or [channel, value]")
+
+func selectArgs(args []V) ([]selectCase, error) {
+    if len(args) == 0 {
+        return nil, errors.New("no cases to select")
+    }
+    cases := make([]selectCase, len(args))
+    for i, x := range args {
+        xs, ok := x.AsArray()
+        if !ok || len(*xs) == 0 || len(*xs) > 2 {
+            return nil, errSelectCase
+        }
+        c, ok := (*xs)[0].val.(*Channel)
+        if !ok {
+            return nil, errSelectCase
+        }
+        cases[i].ch = c
+        if len(*xs) == 2 {
+            cases[i].send = true
+            cases[i].value = (*xs)[1]
+        }
+    }
+    return cases, nil
+}
+
+// Carry out one of the cases, parking the thread until one is ready.
+func (p *Process) waitOn(cases []selectCase, shape resultShape) Action {
+    var sel *selection
+    if p.thread != nil {
+        sel = &selection{shape: shape, thread: p.thread}
+    }
+    r, ready := selectCases(cases, sel)
+    if ready {
+        return selectAction(cases[r.index], r, shape)
+    }
+    if sel == nil {
+        return Throw(errNoScheduler)
+    }
+    return p.thread.park()
+}
+
+func selectAction(sc selectCase, r selectResult, shape resultShape) Action {
+    if sc.send && !r.ok {
+        return Throw(errSendClosed)
+    }
+    return Return(selectValue(r, shape))
+}
@@ -0,0 +1,421 @@
+package script
+
+import (
+    "strings"
+    "testing"
+)
+
+const channelSource = `
+    .import thread thread
+
+    .class Pipe
+
+    ; Sends the second argument down to 1 on the channel, then closes it.
+    .method produce 2
+        FRAME compared
+        GLOBAL 0
+        PUSH
+        BOUND 1
+        LOOKUP eq
+        CALL 1
+    compared:
+        BRANCH send
+        BOUND 0
+        LOOKUP close
+        TCALL 0
+    send:
+        FRAME sent
+        BOUND 1
+        PUSH
+        BOUND 0
+        LOOKUP send
+        CALL 1
+    sent:
+        BOUND 0
+        PUSH
+        FRAME subtracted
+        GLOBAL 1
+        PUSH
+        BOUND 1
+        LOOKUP sub
+        CALL 1
+    subtracted:
+        PUSH
+        THIS
+        LOOKUP produce
+        TCALL 2
+
+    ; Adds what it receives to the second argument until the channel closes.
+    .method consume 2
+        FRAME received
+        BOUND 0
+        LOOKUP receive
+        CALL 0
+    received:
+        PUSH
+        BRANCH done
+        BOUND 0
+        PUSH
+        FRAME added
+        BOUND 2
+        PUSH
+        BOUND 1
+        LOOKUP add
+        CALL 1
+    added:
+        PUSH
+        THIS
+        LOOKUP consume
+        TCALL 2
+    done:
+        BOUND 1
+        RETURN
+
+    ; Doubles what it receives on the first channel and sends it on the
+    ; second, closing the second when the first closes.
+    .method relay 2
+        FRAME received
+        BOUND 0
+        LOOKUP receive
+        CALL 0
+    received:
+        PUSH
+        BRANCH done
+        FRAME doubled
+        GLOBAL 2
+        PUSH
+        BOUND 2
+        LOOKUP mul
+        CALL 1
+    doubled:
+        FRAME sent
+        PUSH
+        BOUND 1
+        LOOKUP send
+        CALL 1
+    sent:
+        BOUND 0
+        PUSH
+        BOUND 1
+        PUSH
+        THIS
+        LOOKUP relay
+        TCALL 2
+    done:
+        BOUND 1
+        LOOKUP close
+        TCALL 0
+    .end
+
+    .method select 2
+        BOUND 0
+        PUSH
+        BOUND 1
+        PUSH
+        GLOBAL thread
+        LOOKUP select
+        TCALL 2
+
+    .method trySelect 2
+        BOUND 0
+        PUSH
+        BOUND 1
+        PUSH
+        GLOBAL thread
+        LOOKUP trySelect
+        TCALL 2
+
+    .method make 1
+        BOUND 0
+        PUSH
+        GLOBAL thread
+        LOOKUP Channel
+        GET
+        LOOKUP new
+        TCALL 1
+
+    .method receive 1
+        BOUND 0
+        LOOKUP receive
+        TCALL 0
+
+    .method receiveOk 1
+        BOUND 0
+        LOOKUP receiveOk
+        TCALL 0
+
+    .method sendOne 1
+        GLOBAL handler
+        HANDLE
+        GLOBAL 1
+        PUSH
+        BOUND 0
+        LOOKUP send
+        TCALL 1
+        RETURN
+
+    .method close 1
+        GLOBAL handler
+        HANDLE
+        BOUND 0
+        LOOKUP close
+        TCALL 0
+        RETURN
+
+    .method handler 1
+        BOUND 0
+        PUSH
+        GLOBAL "caught: "
+        LOOKUP concat
+        TCALL 1
+`
+
+func (tt *threadTest) run(t *testing.T, name string, args ...V) (V, error) {
+    entry, _ := tt.asm.Entry(name)
+    return tt.host.Run(tt.unit, entry, V{}, args...)
+}
+
+func TestMakeChannel(t *testing.T) {
+    tt := newThreadTest(t, channelSource)
+    for i, test := range ([]struct{capacity V; result int; err string}{
+        {Int(0), 0, ""},
+        {Int(3), 3, ""},
+        {Int(-1), 0, "capacity must be a non-negative Integer"},
+        {String("x"), 0, "capacity must be a non-negative Integer"},
+    }) {
+        x, err := tt.run(t, "make", test.capacity)
+        if test.err != "" {
+            if err == nil || !strings.Contains(err.Error(), test.err) {
+                t.Errorf("[%d]: unexpected error %v", i, err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("[%d]: %v", i, err)
+            continue
+        }
+        c, ok := x.AsChannel()
+        if !ok || c.capacity != test.result {
+            t.Errorf("[%d]: %#v", i, x)
+        }
+    }
+}
+
+func TestChannelThreads(t *testing.T) {
+    tt := newThreadTest(t, channelSource)
+    pipe, _ := tt.host.New(tt.value("Pipe"))
+    for i, test := range ([]struct{capacity, quantum int}{
+        {0, 1000},
+        {3, 1000},
+        {0, 5},
+        {3, 5},
+    }) {
+        s := tt.host.NewScheduler()
+        s.Quantum = test.quantum
+        ch := V{newChannel(test.capacity)}
+        total := tt.spawn(t, s, "Pipe.consume", pipe, ch, Int(0))
+        tt.spawn(t, s, "Pipe.produce", pipe, ch, Int(10))
+        if err := s.Run(); err != nil {
+            t.Errorf("[%d]: %v", i, err)
+            continue
+        }
+        if result, err := total.Result(); err != nil || result != Int(55) {
+            t.Errorf("[%d]: %#v, %v", i, result, err)
+        }
+    }
+}
+
+func TestChannelHost(t *testing.T) {
+    tt := newThreadTest(t, channelSource)
+    pipe, _ := tt.host.New(tt.value("Pipe"))
+    in, out := tt.host.NewChannel(0), tt.host.NewChannel(1)
+    s := tt.host.NewScheduler()
+    tt.spawn(t, s, "Pipe.relay", pipe, in, out)
+    done := make(chan error)
+    go func() {
+        done <- s.Run()
+    }()
+    inc, _ := in.AsChannel()
+    outc, _ := out.AsChannel()
+    for i := 1; i <= 5; i++ {
+        if err := inc.Send(Int(int64(i))); err != nil {
+            t.Fatal(err)
+        }
+        if x, ok := outc.Receive(); !ok || x != Int(int64(i*2)) {
+            t.Errorf("[%d]: %#v, %v", i, x, ok)
+        }
+    }
+    inc.Close()
+    if x, ok := outc.Receive(); ok {
+        t.Errorf("received %#v after closing", x)
+    }
+    if err := <-done; err != nil {
+        t.Error(err)
+    }
+    if err := inc.Send(Int(1)); err != ErrChannelClosed {
+        t.Errorf("unexpected error %v", err)
+    }
+    if err := inc.Close(); err != ErrChannelClosed {
+        t.Errorf("unexpected error %v", err)
+    }
+}
+
+func TestChannelShare(t *testing.T) {
+    tt := newThreadTest(t, channelSource)
+    // Getting at a channel does not share it.
+    unshared := V{newChannel(0)}
+    unshared.AsChannel()
+    s := tt.host.NewScheduler()
+    tt.spawn(t, s, "receive", V{}, unshared)
+    if err := s.Run(); err != ErrDeadlock {
+        t.Errorf("expected deadlock, got %v", err)
+    }
+    ch := V{newChannel(0)}
+    c, _ := ch.AsChannel()
+    c.Share()
+    s = tt.host.NewScheduler()
+    th := tt.spawn(t, s, "receive", V{}, ch)
+    go c.Send(Int(1))
+    if err := s.Run(); err != nil {
+        t.Fatal(err)
+    }
+    if result, err := th.Result(); err != nil || result != Int(1) {
+        t.Errorf("%#v, %v", result, err)
+    }
+}
+
+func TestSelect(t *testing.T) {
+    tt := newThreadTest(t, channelSource)
+    pipe, _ := tt.host.New(tt.value("Pipe"))
+    for i, test := range ([]struct{
+        entry string
+        a, b int
+        // Values buffered on the channels to begin with.
+        bufA, bufB []V
+        produceB bool
+        result V
+    }{
+        {"select", 1, 1, nil, []V{Int(7)}, false, Array(Int(1), Int(7), Bool(true))},
+        {"select", 1, 1, []V{Int(6)}, []V{Int(7)}, false, Array(Int(0), Int(6), Bool(true))},
+        {"select", 0, 0, nil, nil, true, Array(Int(1), Int(1), Bool(true))},
+        {"trySelect", 0, 0, nil, nil, false, Nil()},
+        {"trySelect", 1, 1, nil, []V{Int(7)}, false, Array(Int(1), Int(7), Bool(true))},
+        {"trySelect", 1, 1, nil, []V{Nil()}, false, Array(Int(1), Nil(), Bool(true))},
+    }) {
+        a, b := newChannel(test.a), newChannel(test.b)
+        a.buf = append(a.buf, test.bufA...)
+        b.buf = append(b.buf, test.bufB...)
+        s := tt.host.NewScheduler()
+        th := tt.spawn(t, s, test.entry, V{}, Array(V{a}), Array(V{b}))
+        if test.produceB {
+            tt.spawn(t, s, "Pipe.produce", pipe, V{b}, Int(1))
+        }
+        if err := s.Run(); err != nil {
+            t.Errorf("[%d]: %v", i, err)
+            continue
+        }
+        result, err := th.Result()
+        if err != nil {
+            t.Errorf("[%d]: %v", i, err)
+        }
+        if test.result.IsNil() {
+            if !result.IsNil() {
+                t.Errorf("[%d]: %#v != nil", i, result)
+            }
+        } else if !sameArray(result, test.result) {
+            t.Errorf("[%d]: %v != %v", i, result.val, test.result.val)
+        }
+    }
+}
+
+func TestSelectSend(t *testing.T) {
+    tt := newThreadTest(t, channelSource)
+    full, space := newChannel(1), newChannel(1)
+    full.buf = []V{Int(1)}
+    result, err := tt.run(t, "trySelect", Array(V{full}, Int(2)), Array(V{space}, Int(3)))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !sameArray(result, Array(Int(1), Nil(), Bool(true))) {
+        t.Errorf("unexpected result %v", result.val)
+    }
+    if len(space.buf) != 1 || space.buf[0] != Int(3) {
+        t.Errorf("buffer is %v", space.buf)
+    }
+}
+
+// Nil and false are values like any other, and only ok says that the channel
+// is closed.
+func TestReceiveOk(t *testing.T) {
+    tt := newThreadTest(t, channelSource)
+    c := newChannel(3)
+    for _, x := range []V{Nil(), Bool(false), Int(1)} {
+        if err := c.Send(x); err != nil {
+            t.Fatal(err)
+        }
+    }
+    c.Close()
+    for i, expected := range []V{
+        Array(Nil(), Bool(true)),
+        Array(Bool(false), Bool(true)),
+        Array(Int(1), Bool(true)),
+        Array(Nil(), Bool(false)),
+    } {
+        result, err := tt.run(t, "receiveOk", V{c})
+        if err != nil {
+            t.Errorf("[%d]: %v", i, err)
+            continue
+        }
+        if !sameArray(result, expected) {
+            t.Errorf("[%d]: %v != %v", i, result.val, expected.val)
+        }
+    }
+    result, err := tt.run(t, "trySelect", Array(V{c}), Array(V{newChannel(0)}))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !sameArray(result, Array(Int(0), Nil(), Bool(false))) {
+        t.Errorf("unexpected result %v", result.val)
+    }
+}
+
+func TestChannelErrors(t *testing.T) {
+    tt := newThreadTest(t, channelSource)
+    closed := newChannel(1)
+    closed.Close()
+    for i, test := range ([]struct{entry string; arg V; result V; err string}{
+        {"sendOne", V{closed}, String("caught: send on closed channel"), ""},
+        {"close", V{closed}, String("caught: channel is closed"), ""},
+        {"receive", V{closed}, Nil(), ""},
+        {"receive", V{newChannel(0)}, V{}, "not running in a scheduler"},
+        {"select", Array(), V{}, "cases must be"},
+    }) {
+        args := []V{test.arg}
+        if test.entry == "select" {
+            args = append(args, test.arg)
+        }
+        result, err := tt.run(t, test.entry, args...)
+        if test.err != "" {
+            if err == nil || !strings.Contains(err.Error(), test.err) {
+                t.Errorf("[%d]: unexpected error %v", i, err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("[%d]: %v", i, err)
+        }
+        if result != test.result {
+            t.Errorf("[%d]: %#v != %#v", i, result, test.result)
+        }
+    }
+}
+
+func TestChannelDeadlock(t *testing.T) {
+    tt := newThreadTest(t, channelSource)
+    pipe, _ := tt.host.New(tt.value("Pipe"))
+    s := tt.host.NewScheduler()
+    tt.spawn(t, s, "Pipe.consume", pipe, V{newChannel(0)}, Int(0))
+    if err := s.Run(); err != ErrDeadlock {
+        t.Errorf("expected deadlock, got %v", err)
+    }
+}
@@ -1,15 +1,317 @@
 package script
 
-import ()
+import (
+    "errors"
+    "sort"
+)
+
+var (
+    ErrFieldCount = errors.New("too many field values")
+    ErrMemberName = errors.New("member defined more than once")
+    ErrNilMethod = errors.New("method value is nil")
+)
 
 type builtinClasses struct {
     Object, Class V
     Integer, Float, String V
-    Primitive, Field, Array V
+    Primitive, Method, Field, Array V
+    Iterator, Boolean, Nil, Closure V
+    Thread, Channel V
 }
 
 func (e *Interpreter) initBuiltins() {
-    
+    ns := &e.builtins.names
+    ns.lookup = V{e.Intern("lookup")}
+    ns.getSlot = V{e.Intern("getSlot")}
+    ns.setSlot = V{e.Intern("setSlot")}
+    ns.callSlot = V{e.Intern("callSlot")}
+    ns.new = V{e.Intern("new")}
+    ns.init = V{e.Intern("init")}
+    ns.extend = V{e.Intern("extend")}
+
+    cs := &e.builtins.classes
+    object := newClass(
+        e.Intern("Object"), nil,
+        []*Name{ns.getSlot.val.(*Name)},
+        []V{V{Primitive(getSelf)}},
+    )
+    builtin := func(name string) V {
+        return V{newClass(e.Intern(name), object, nil, nil)}
+    }
+    cs.Object = V{object}
+    cs.Class = V{newClass(
+        e.Intern("Class"), object,
+        []*Name{ns.new.val.(*Name), ns.extend.val.(*Name)},
+        []V{V{Primitive(newObject)}, V{Primitive(extendClass)}},
+    )}
+    cs.Integer = builtin("Integer")
+    cs.Float = builtin("Float")
+    cs.String = builtin("String")
+    cs.Primitive = builtin("Primitive")
+    cs.Field = builtin("Field")
+    cs.Array = builtin("Array")
+    cs.Iterator = builtin("Iterator")
+    cs.Boolean = builtin("Boolean")
+    cs.Nil = builtin("Nil")
+    cs.Method = V{newClass(
+        e.Intern("Method"), object,
+        []*Name{ns.callSlot.val.(*Name)},
+        []V{V{Primitive(callMethod)}},
+    )}
+    e.initArrays()
+    e.initStrings()
+    e.initNumbers()
+    e.initBooleans()
+    e.initClosures()
+}
+
+// Members of builtin classes are either primitives, Go functions of the kind
+// accepted by DefinePrimitive, or values such as classes, which are defined as
+// they are.
+type builtinMember struct {
+    name string
+    fn interface{}
+}
+
+func (e *Interpreter) defineBuiltins(cls V, members []builtinMember) {
+    c := cls.val.(*class)
+    for _, m := range members {
+        var prim Primitive
+        switch fn := m.fn.(type) {
+        case V:
+            c.define(e.Intern(m.name), fn)
+            continue
+        case Primitive:
+            prim = fn
+        case func(*Process) Action:
+            prim = fn
+        default:
+            var err error
+            prim, err = nativePrimitive(fn)
+            if err != nil {
+                panic(m.name + ": " + err.Error())
+            }
+        }
+        c.define(e.Intern(m.name), V{prim})
+    }
+}
+
+// Create a class that extends ancestor, which may be nil, with some members.
+// The new class takes the ancestor's members and then any members with the
+// same name are overridden.
+func newClass(name *Name, ancestor *class, names []*Name, values []V) *class {
+    c := &class{name: name, ancestor: ancestor}
+    base := new(shape).init(nil, nil, 0)
+    if ancestor != nil {
+        base = ancestor.getMembers().shape
+    }
+    ms := &classMembers{shape: base.extend(names)}
+    ms.names = make([]*Name, ms.shape.size)
+    ms.values = make([]V, ms.shape.size)
+    if ancestor != nil {
+        inherited := ancestor.getMembers()
+        copy(ms.names, inherited.names)
+        copy(ms.values, inherited.values)
+    }
+    for i, n := range names {
+        offset := ms.shape.lookup(n)
+        ms.names[offset] = n
+        ms.values[offset] = values[i]
+    }
+    c.setMembers(ms)
+    return c
+}
+
+// Fields are only meaningful as members of a class, which gives them their
+// offset, so until then they are just a name.
+type fieldDecl struct {
+    name *Name
+}
+
+// Create a class from its member declarations. Members whose value is a
+// *fieldDecl become fields at the offset the class's shape gives them.
+func (host *Interpreter) makeClass(name *Name, ancestor *class, names []*Name, values []V) *class {
+    c := newClass(name, ancestor, names, values)
+    ms := c.getMembers()
+    for i, x := range values {
+        if _, ok := x.val.(*fieldDecl); ok {
+            offset := ms.shape.lookup(names[i])
+            ms.values[offset] = host.newField(offset)
+        }
+    }
+    return c
+}
+
+// Create a class that extends ancestor, or Object if ancestor is nil. The class
+// has the ancestor's members, followed by the fields and then the methods, which
+// override any ancestor members with the same name.
+func (host *Interpreter) DefineClass(name string, ancestor V, fields []string, methods map[string]V) (V, error) {
+    base, err := host.ancestorClass(ancestor)
+    if err != nil {
+        return V{}, err
+    }
+    var names []*Name
+    var values []V
+    seen := map[string]bool{}
+    declare := func(n string, x V) error {
+        if seen[n] {
+            return ErrMemberName
+        }
+        seen[n] = true
+        m := host.Intern(n)
+        names = append(names, m)
+        if x.val == nil {
+            x = V{&fieldDecl{m}}
+        }
+        values = append(values, x)
+        return nil
+    }
+    for _, n := range fields {
+        if err := declare(n, V{}); err != nil {
+            return V{}, err
+        }
+    }
+    // Sorted so that the layout does not depend on the order of the map. As
+    // names are interned, classes with the same members then get the same
+    // shape.
+    var methodNames []string
+    for n := range methods {
+        methodNames = append(methodNames, n)
+    }
+    sort.Strings(methodNames)
+    for _, n := range methodNames {
+        if methods[n].val == nil {
+            return V{}, ErrNilMethod
+        }
+        if err := declare(n, methods[n]); err != nil {
+            return V{}, err
+        }
+    }
+    return V{host.makeClass(host.Intern(name), base, names, values)}, nil
+}
+
+func (host *Interpreter) ancestorClass(x V) (*class, error) {
+    if x.val == nil {
+        return host.builtins.classes.Object.val.(*class), nil
+    }
+    c, ok := x.val.(*class)
+    if !ok {
+        return nil, ErrNotClass
+    }
+    return c, nil
 }
 
+// Class.extend(name, fields, methods) creates a class that derives from the
+// receiver. The fields are an array of strings and the methods an array of
+// methods, which are added under their own names.
+func extendClass(p *Process) Action {
+    args := p.Args()
+    if len(args) != 3 {
+        return Throw(String("wrong number of arguments"))
+    }
+    name, ok := args[0].AsString()
+    if !ok {
+        return Throw(String("argument 1: expected String"))
+    }
+    fieldList, fieldsOk := args[1].val.(*[]V)
+    methodList, methodsOk := args[2].val.(*[]V)
+    if !(fieldsOk && methodsOk) {
+        return Throw(String("expected an array"))
+    }
+    var fields []string
+    for _, x := range *fieldList {
+        n, ok := x.AsString()
+        if !ok {
+            return Throw(String("field names must be strings"))
+        }
+        fields = append(fields, n)
+    }
+    methods := map[string]V{}
+    for _, x := range *methodList {
+        m, ok := x.val.(*method)
+        if !ok || m.name == nil {
+            return Throw(String("expected a named method"))
+        }
+        if _, ok := methods[m.name.String()]; ok {
+            return Throw(String(ErrMemberName.Error()))
+        }
+        methods[m.name.String()] = x
+    }
+    c, err := p.host.DefineClass(name, p.Receiver(), fields, methods)
+    if err != nil {
+        return Throw(String(err.Error()))
+    }
+    return Return(c)
+}
 
+// Fields are instances of Field that hold the offset of their value within an
+// object.
+func (host *Interpreter) newField(offset int) V {
+    return V{&UserObject{host.builtins.classes.Field, []V{Int(int64(offset))}}}
+}
+
+// Create an instance of a class. The object has a slot for every member of the
+// class, and fieldValues are assigned to its fields in offset order. Any fields
+// left over are nil.
+func (host *Interpreter) New(cls V, fieldValues ...V) (V, error) {
+    c, ok := cls.val.(*class)
+    if !ok {
+        return V{}, ErrNotClass
+    }
+    ms := c.getMembers()
+    obj := &UserObject{cls, make([]V, ms.shape.size)}
+    for _, x := range ms.values {
+        if len(fieldValues) == 0 {
+            break
+        }
+        if host.ClassOf(x) != host.builtins.classes.Field {
+            continue
+        }
+        offset, _ := x.val.(*UserObject).fields[0].AsInt()
+        obj.fields[offset] = fieldValues[0]
+        fieldValues = fieldValues[1:]
+    }
+    if len(fieldValues) != 0 {
+        return V{}, ErrFieldCount
+    }
+    return V{obj}, nil
+}
+
+// Class.new creates an instance of the receiver. If the class has an init
+// member then it is called on the new object with the arguments, otherwise the
+// arguments are assigned to the object's fields as with Interpreter.New.
+func newObject(p *Process) Action {
+    c := p.Receiver().val.(*class)
+    if c.newFn != nil {
+        return c.newFn(p)
+    }
+    init, err := c.lookup(p.host.builtins.names.init.val.(*Name))
+    if err != nil {
+        obj, err := p.host.New(p.Receiver(), p.Args()...)
+        if err != nil {
+            return Throw(String(err.Error()))
+        }
+        return Return(obj)
+    }
+    obj, _ := p.host.New(p.Receiver())
+    return CallThen(func(p *Process, x V) Action {
+        return Return(obj)
+    }, init, obj, p.Args()...)
+}
+
+// Members that are not fields read as themselves.
+func getSelf(p *Process) Action {
+    return Return(p.Receiver())
+}
+
+// Methods are called with their receiver as the last argument.
+func callMethod(p *Process) Action {
+    m := p.result.val.(*method)
+    if p.argc-1 != m.argc {
+        p.throwError("wrong number of arguments")
+        return Action{}
+    }
+    this := p.pop()
+    p.start(m, this, m.argc)
+    return Action{}
+}
@@ -0,0 +1,239 @@
+package script
+
+import (
+    "testing"
+)
+
+func TestClassOf(t *testing.T) {
+    host := New()
+    cs := host.builtins.classes
+    object := cs.Object.val.(*class)
+    if object.ancestor != nil {
+        t.Error("Object should not have an ancestor")
+    }
+    for i, test := range ([]struct{x, class V; name string}{
+        {Int(1), cs.Integer, "Integer"},
+        {Float(1), cs.Float, "Float"},
+        {String("a"), cs.String, "String"},
+        {V{&[]V{}}, cs.Array, "Array"},
+        {cs.Object, cs.Class, "Class"},
+        {V{Primitive(callMethod)}, cs.Primitive, "Primitive"},
+        {V{&method{}}, cs.Method, "Method"},
+        {host.newField(0), cs.Field, "Field"},
+        {True(), cs.Boolean, "Boolean"},
+        {Nil(), cs.Nil, "Nil"},
+    }) {
+        c := host.ClassOf(test.x)
+        if c != test.class {
+            t.Errorf("[%d]: wrong class %#v", i, c)
+            continue
+        }
+        cls := c.val.(*class)
+        if cls.name.str != test.name {
+            t.Errorf("[%d]: wrong name %s", i, cls.name.str)
+        }
+        if cls.ancestor != object {
+            t.Errorf("[%d]: %s does not derive from Object", i, test.name)
+        }
+    }
+}
+
+func TestCallMethod(t *testing.T) {
+    host := New()
+    u := &Unit{}
+    name := new(Name).init("second")
+    second := newMethod(name, 2, Code{BOUND, 1, RETURN}, u)
+    cls := newClass(new(Name).init("Test"), host.builtins.classes.Object.val.(*class), []*Name{name}, []V{V{second}})
+    u.Values = []V{
+        Int(1),
+        Int(2),
+        V{&UserObject{V{cls}, nil}},
+        V{name},
+        V{newMethod(nil, 0, Code{
+            FRAME, 27,0,
+            GLOBAL, 0,0,0,0, PUSH,
+            GLOBAL, 1,0,0,0, PUSH,
+            GLOBAL, 2,0,0,0,
+            LOOKUP, 3,0,0,0,
+            CALL, 2,
+            RETURN,
+        }, u)},
+        V{newMethod(nil, 0, Code{
+            GLOBAL, 0,0,0,0, PUSH,
+            GLOBAL, 2,0,0,0,
+            LOOKUP, 3,0,0,0,
+            TCALL, 1,
+        }, u)},
+    }
+    result, err := host.Run(u, 4, V{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if result != Int(2) {
+        t.Errorf("%#v != 2", result)
+    }
+    _, err = host.Run(u, 5, V{})
+    if serr, ok := err.(*ScriptError); !ok || serr.Value != String("wrong number of arguments") {
+        t.Errorf("unexpected error %v", err)
+    }
+}
+
+func TestNew(t *testing.T) {
+    host := New()
+    u, a := assembleUnit(t, host, `
+        .class Point
+        .field x
+        .field y
+        .method getX 0
+            THIS
+            LOOKUP x
+            GET
+            RETURN
+        .method setY 1
+            BOUND 0
+            PUSH
+            THIS
+            LOOKUP y
+            SET
+            THIS
+            LOOKUP y
+            TGET
+        .end
+
+        .method init 2
+            BOUND 0
+            PUSH
+            THIS
+            LOOKUP x
+            SET
+            BOUND 1
+            PUSH
+            THIS
+            LOOKUP y
+            SET
+            RETURN
+    `)
+    entry := func(name string) V {
+        id, _ := a.Entry(name)
+        return u.Values[id]
+    }
+    point := entry("Point")
+    field := func(obj V, name string) V {
+        c := point.val.(*class)
+        return obj.val.(*UserObject).fields[c.getMembers().shape.lookup(testName(c, name))]
+    }
+    obj, err := host.New(point, Int(1), Int(2))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if field(obj, "x") != Int(1) || field(obj, "y") != Int(2) {
+        t.Errorf("unexpected fields %#v", obj)
+    }
+    getX, _ := a.Entry("Point.getX")
+    if result, err := host.Run(u, getX, obj); err != nil || result != Int(1) {
+        t.Errorf("getX: %#v, %v", result, err)
+    }
+    setY, _ := a.Entry("Point.setY")
+    if result, err := host.Run(u, setY, obj, Int(5)); err != nil || result != Int(5) {
+        t.Errorf("setY: %#v, %v", result, err)
+    }
+    if _, err := host.New(point, Int(1), Int(2), Int(3)); err != ErrFieldCount {
+        t.Errorf("unexpected error %v", err)
+    }
+    if _, err := host.New(Int(1)); err != ErrNotClass {
+        t.Errorf("unexpected error %v", err)
+    }
+    if _, err := host.Run(u, getX, Int(1)); err == nil {
+        t.Error("expected an error reading a field of an integer")
+    }
+
+    newName := host.builtins.names.new.val.(*Name)
+    result, err := host.Run(sendUnit(point, newName, Int(3)), 0, V{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if field(result, "x") != Int(3) || field(result, "y") != (V{}) {
+        t.Errorf("unexpected fields %#v", result)
+    }
+    point.val.(*class).define(host.builtins.names.init.val.(*Name), entry("init"))
+    result, err = host.Run(sendUnit(point, newName, Int(3), Int(4)), 0, V{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if field(result, "x") != Int(3) || field(result, "y") != Int(4) {
+        t.Errorf("unexpected fields %#v", result)
+    }
+}
+
+func TestDefineClass(t *testing.T) {
+    host := New()
+    one, two := String("one"), String("two")
+    base, err := host.DefineClass("Base", V{}, []string{"x"}, map[string]V{"f": one, "g": one})
+    if err != nil {
+        t.Fatal(err)
+    }
+    derived, err := host.DefineClass("Derived", base, []string{"y"}, map[string]V{"g": two})
+    if err != nil {
+        t.Fatal(err)
+    }
+    c := derived.val.(*class)
+    if c.ancestor != base.val.(*class) || c.name.str != "Derived" {
+        t.Errorf("unexpected class %#v", c)
+    }
+    for i, name := range c.getMembers().names {
+        x := c.getMembers().values[i]
+        switch name.str {
+        case "x", "y":
+            if host.ClassOf(x) != host.builtins.classes.Field {
+                t.Errorf("%s is not a field", name.str)
+                continue
+            }
+            if offset, _ := x.val.(*UserObject).fields[0].AsInt(); offset != int64(i) {
+                t.Errorf("%s has offset %d, expected %d", name.str, offset, i)
+            }
+        case "f":
+            if x != one {
+                t.Errorf("f was not inherited")
+            }
+        case "g":
+            if x != two {
+                t.Errorf("g was not overridden")
+            }
+        case "getSlot":
+        default:
+            t.Errorf("unexpected member %s", name.str)
+        }
+    }
+    again, _ := host.DefineClass("Base", V{}, []string{"x"}, map[string]V{"g": one, "f": one})
+    if again.val.(*class).getMembers().shape.size != base.val.(*class).getMembers().shape.size {
+        t.Error("classes with the same members have different sizes")
+    }
+    if _, err := host.DefineClass("Bad", Int(1), nil, nil); err != ErrNotClass {
+        t.Errorf("unexpected error %v", err)
+    }
+    if _, err := host.DefineClass("Bad", V{}, []string{"f"}, map[string]V{"f": one}); err != ErrMemberName {
+        t.Errorf("unexpected error %v", err)
+    }
+    if _, err := host.DefineClass("Bad", V{}, nil, map[string]V{"f": V{}}); err != ErrNilMethod {
+        t.Errorf("unexpected error %v", err)
+    }
+
+    u := &Unit{}
+    m := V{newMethod(new(Name).init("m"), 0, Code{THIS, RETURN}, u)}
+    extend := host.builtins.names.extend.val.(*Name)
+    result, err := host.Run(sendUnit(base, extend, String("Script"), V{&[]V{String("z")}}, V{&[]V{m}}), 0, V{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    sc := result.val.(*class)
+    if sc.ancestor != base.val.(*class) || sc.getMembers().values[sc.getMembers().shape.lookup(testName(sc, "m"))] != m {
+        t.Errorf("unexpected class %#v", sc)
+    }
+    if z := sc.getMembers().values[sc.getMembers().shape.lookup(testName(sc, "z"))]; host.ClassOf(z) != host.builtins.classes.Field {
+        t.Errorf("z is not a field")
+    }
+    _, err = host.Run(sendUnit(base, extend, String("Script"), V{&[]V{}}, V{&[]V{one}}), 0, V{})
+    if serr, ok := err.(*ScriptError); !ok || serr.Value != String("expected a named method") {
+        t.Errorf("unexpected error %v", err)
+    }
+}
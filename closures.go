@@ -0,0 +1,65 @@
+package script
+
+import ()
+
+// Variables that closures capture live in cells, so that the closure and the
+// frame that defined it share any changes. CELL n moves local n into a new
+// cell, after which BOUND n gives the cell rather than its value. LOAD reads
+// the cell in the result and STORE pops a value and writes it to the cell in
+// the result.
+//
+// CLOSURE n pops n values, usually cells, and combines them with the method in
+// the result to make a closure. When the closure is called the method runs
+// with the same receiver as the code that created it, and FREE n gives the
+// nth captured value.
+type cell struct {
+    value V
+}
+
+type closure struct {
+    method *method
+    this V
+    free []V
+}
+
+func (p *Process) makeClosure(n int) {
+    m, ok := p.result.val.(*method)
+    if !ok {
+        p.throwError("not a method")
+        return
+    }
+    free := make([]V, n)
+    copy(free, p.stack[len(p.stack)-n:])
+    p.stack = p.stack[:len(p.stack)-n]
+    p.result = V{&closure{m, p.this, free}}
+}
+
+func (e *Interpreter) initClosures() {
+    cs := &e.builtins.classes
+    cs.Closure = V{newClass(
+        e.Intern("Closure"), cs.Object.val.(*class),
+        []*Name{e.builtins.names.callSlot.val.(*Name)},
+        []V{V{Primitive(callClosure)}},
+    )}
+    e.defineBuiltins(cs.Closure, []builtinMember{
+        {"call", callValue},
+    })
+}
+
+// Closures are called like methods, but the receiver is ignored.
+func callClosure(p *Process) Action {
+    c := p.result.val.(*closure)
+    if p.argc-1 != c.method.argc {
+        p.throwError("wrong number of arguments")
+        return Action{}
+    }
+    p.pop()
+    p.start(c.method, c.this, c.method.argc)
+    p.closure = c.free
+    return Action{}
+}
+
+// x.call(args...) calls x with the arguments.
+func callValue(p *Process) Action {
+    return Call(p.Receiver(), V{}, p.Args()...)
+}
@@ -0,0 +1,119 @@
+package script
+
+import (
+    "testing"
+)
+
+func TestClosures(t *testing.T) {
+    host := New()
+    u, a := assembleUnit(t, host, `
+        ; Returns a closure that adds one to start and returns the new value.
+        .method counter 1
+            CELL 0
+            BOUND 0
+            PUSH
+            GLOBAL increment
+            CLOSURE 1
+            RETURN
+        .method increment 0
+            FRAME added
+            GLOBAL 1
+            PUSH
+            FREE 0
+            LOAD
+            LOOKUP add
+            CALL 1
+        added:
+            PUSH
+            FREE 0
+            STORE
+            FREE 0
+            LOAD
+            RETURN
+
+        .method callTwice 1
+            FRAME first
+            BOUND 0
+            LOOKUP call
+            CALL 0
+        first:
+            BOUND 0
+            LOOKUP call
+            TCALL 0
+
+        ; The closure changes a variable of the frame that made it.
+        .method shared 0
+            GLOBAL 1
+            PUSH
+            CELL 0
+            FRAME called
+            BOUND 0
+            PUSH
+            GLOBAL setTen
+            CLOSURE 1
+            LOOKUP call
+            CALL 0
+        called:
+            BOUND 0
+            LOAD
+            RETURN
+        .method setTen 0
+            GLOBAL 10
+            PUSH
+            FREE 0
+            STORE
+            RETURN
+
+        .method self 0
+            GLOBAL getThis
+            CLOSURE 0
+            LOOKUP call
+            TCALL 0
+        .method getThis 0
+            THIS
+            RETURN
+
+        .method arity 0
+            GLOBAL 1
+            PUSH
+            GLOBAL getThis
+            CLOSURE 0
+            LOOKUP call
+            TCALL 1
+    `)
+    if err := u.Verify(); err != nil {
+        t.Fatal(err)
+    }
+    entry := func(name string) int {
+        id, _ := a.Entry(name)
+        return id
+    }
+    c, err := host.Run(u, entry("counter"), V{}, Int(5))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if host.ClassOf(c) != host.builtins.classes.Closure {
+        t.Fatalf("unexpected result %#v", c)
+    }
+    for i, test := range ([]struct{entry string; this V; args []V; result V; thrown string}{
+        {"callTwice", V{}, []V{c}, Int(7), ""},
+        {"callTwice", V{}, []V{c}, Int(9), ""},
+        {"shared", V{}, nil, Int(10), ""},
+        {"self", Int(3), nil, Int(3), ""},
+        {"arity", V{}, nil, V{}, "wrong number of arguments"},
+    }) {
+        result, err := host.Run(u, entry(test.entry), test.this, test.args...)
+        if test.thrown != "" {
+            if serr, ok := err.(*ScriptError); !ok || serr.Value != String(test.thrown) {
+                t.Errorf("[%d]: unexpected error %v", i, err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("[%d]: unexpected error %v", i, err)
+        }
+        if result != test.result {
+            t.Errorf("[%d]: %#v != %#v", i, result, test.result)
+        }
+    }
+}
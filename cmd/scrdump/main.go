@@ -0,0 +1,45 @@
+// Print the contents of bytecode images, including listings of their methods.
+//
+// Usage:
+//
+//     scrdump image...
+package main
+
+import (
+    "fmt"
+    "os"
+
+    "github.com/bobappleyard/script"
+)
+
+func main() {
+    if len(os.Args) < 2 {
+        fmt.Fprintln(os.Stderr, "usage: scrdump image...")
+        os.Exit(2)
+    }
+    status := 0
+    for _, path := range os.Args[1:] {
+        if err := dump(path); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+            status = 1
+        }
+    }
+    os.Exit(status)
+}
+
+func dump(path string) error {
+    f, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    u, err := script.New().Decode(f)
+    if err != nil {
+        return err
+    }
+    if len(os.Args) > 2 {
+        fmt.Printf("%s:\n", path)
+    }
+    fmt.Print(script.DisassembleUnit(u))
+    return nil
+}
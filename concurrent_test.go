@@ -0,0 +1,97 @@
+package script
+
+import (
+    "testing"
+    "sync"
+)
+
+// These tests are most useful when run with the race detector.
+
+func parallel(n int, fn func(i int)) {
+    var wg sync.WaitGroup
+    for i := 0; i < n; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            fn(i)
+        }(i)
+    }
+    wg.Wait()
+}
+
+func TestConcurrentExtend(t *testing.T) {
+    base := new(shape).init(nil, nil, 0)
+    names := make([]*Name, 8)
+    for i := range names {
+        names[i] = new(Name).init("n")
+    }
+    shapes := make([]*shape, 64)
+    parallel(len(shapes), func(i int) {
+        // Each goroutine adds an overlapping selection of names, one at a time.
+        s := base
+        for j := 0; j < 4; j++ {
+            s = s.extend([]*Name{names[(i+j) % len(names)]})
+        }
+        shapes[i] = s
+    })
+    for i, s := range shapes {
+        seen := map[int]bool{}
+        for j := 0; j < 4; j++ {
+            offset := s.lookup(names[(i+j) % len(names)])
+            if offset < 0 || offset >= s.size || seen[offset] {
+                t.Errorf("[%d]: bad offset %d for name %d", i, offset, j)
+            }
+            seen[offset] = true
+        }
+        if s.size != 4 {
+            t.Errorf("[%d]: size %d", i, s.size)
+        }
+    }
+}
+
+func TestConcurrentAppendItem(t *testing.T) {
+    n := new(Name).init("n")
+    parallel(32, func(i int) {
+        for j := 0; j < 10; j++ {
+            n.appendItem(nameItem{entityId(i*10 + j), j})
+        }
+    })
+    items := n.getItems()
+    if len(items) != 320 {
+        t.Fatalf("%d items", len(items))
+    }
+    for i, item := range items {
+        if item.introduced != entityId(i) {
+            t.Errorf("[%d]: items out of order: %v", i, item)
+            break
+        }
+    }
+}
+
+func TestConcurrentProcesses(t *testing.T) {
+    host := New()
+    u, entry, obj := counter(t, host)
+    counterClass := obj.val.(*UserObject).class
+    parallel(16, func(i int) {
+        if i % 4 == 0 {
+            // Adding members changes the class's shape while the others are
+            // looking members up in it.
+            for j := 0; j < 20; j++ {
+                host.Define(counterClass, "extra", Int(int64(j)))
+                host.Define(counterClass, "extra" + string(rune('a' + i)), Int(int64(j)))
+            }
+            return
+        }
+        for j := 0; j < 5; j++ {
+            result, err := host.Run(u, entry, obj, Int(0), Int(100))
+            if err != nil || result != Int(100) {
+                t.Errorf("[%d]: %#v, %v", i, result, err)
+                return
+            }
+        }
+    })
+    x, err := counterClass.val.(*class).lookup(host.Intern("extra"))
+    if err != nil || x != Int(19) {
+        t.Errorf("extra is %#v, %v", x, err)
+    }
+}
@@ -0,0 +1,134 @@
+package script
+
+import (
+    "fmt"
+    "strings"
+)
+
+// The mnemonic for each opcode and the size of its operand in bytes.
+var opcodes = [...]struct{name string; operand int}{
+    HALT: {"HALT", 0},
+    THIS: {"THIS", 0},
+    BOUND: {"BOUND", 1},
+    FREE: {"FREE", 2},
+    GLOBAL: {"GLOBAL", 4},
+    JUMP: {"JUMP", 2},
+    BRANCH: {"BRANCH", 2},
+    PUSH: {"PUSH", 0},
+    LOOKUP: {"LOOKUP", 4},
+    GET: {"GET", 0},
+    SET: {"SET", 0},
+    CALL: {"CALL", 1},
+    TGET: {"TGET", 0},
+    TCALL: {"TCALL", 1},
+    FRAME: {"FRAME", 2},
+    RETURN: {"RETURN", 0},
+    THROW: {"THROW", 0},
+    HANDLE: {"HANDLE", 0},
+    CELL: {"CELL", 1},
+    LOAD: {"LOAD", 0},
+    STORE: {"STORE", 0},
+    CLOSURE: {"CLOSURE", 1},
+    RESUME: {"RESUME", 0},
+}
+
+// Decode the operand of size n at pos, as Process.run would.
+func operandAt(code Code, pos, n int) int {
+    x := 0
+    for i := n-1; i >= 0; i-- {
+        x = (x << 8) + int(code[pos+i])
+    }
+    return x
+}
+
+// Render code as a listing with one instruction per line. Each line gives the
+// offset of the instruction, its mnemonic and its operand. Operands that refer
+// to the unit's values are followed by a description of the value.
+func Disassemble(code Code, u *Unit) string {
+    var b strings.Builder
+    for pos := 0; pos < len(code); {
+        op := int(code[pos])
+        fmt.Fprintf(&b, "%04d  ", pos)
+        pos++
+        if op >= len(opcodes) {
+            fmt.Fprintf(&b, "??? %d\n", op)
+            continue
+        }
+        info := opcodes[op]
+        if info.operand == 0 {
+            fmt.Fprintf(&b, "%s\n", info.name)
+            continue
+        }
+        if pos + info.operand > len(code) {
+            fmt.Fprintf(&b, "%-8s <truncated>\n", info.name)
+            break
+        }
+        x := operandAt(code, pos, info.operand)
+        pos += info.operand
+        fmt.Fprintf(&b, "%-8s %d", info.name, x)
+        if (op == GLOBAL || op == LOOKUP) && u != nil {
+            if x < len(u.Values) {
+                fmt.Fprintf(&b, "\t; %s", describe(u.Values[x]))
+            } else {
+                fmt.Fprintf(&b, "\t; out of range")
+            }
+        }
+        b.WriteString("\n")
+    }
+    return b.String()
+}
+
+// Render every value in a unit, including listings of its methods.
+func DisassembleUnit(u *Unit) string {
+    var b strings.Builder
+    for i, x := range u.Values {
+        fmt.Fprintf(&b, "%d: %s\n", i, describe(x))
+        switch xv := x.val.(type) {
+        case *method:
+            for _, line := range strings.SplitAfter(Disassemble(xv.code, u), "\n") {
+                if line != "" {
+                    b.WriteString("    " + line)
+                }
+            }
+        case *class:
+            ms := xv.getMembers()
+            for j, n := range ms.names {
+                if n != nil {
+                    fmt.Fprintf(&b, "    %d: %s = %s\n", j, n.String(), describe(ms.values[j]))
+                }
+            }
+        }
+    }
+    return b.String()
+}
+
+func describe(x V) string {
+    switch xv := x.val.(type) {
+    case nil:
+        return "nil"
+    case bool, int64, float64:
+        return fmt.Sprint(xv)
+    case string:
+        return fmt.Sprintf("%q", xv)
+    case *Name:
+        return "name " + xv.String()
+    case *method:
+        if xv.name == nil {
+            return fmt.Sprintf("method/%d", xv.argc)
+        }
+        return fmt.Sprintf("method %s/%d", xv.name.String(), xv.argc)
+    case *fieldDecl:
+        return "field " + xv.name.String()
+    case *class:
+        return "class " + xv.name.String()
+    case *UserObject:
+        if c, ok := xv.class.val.(*class); ok {
+            return "instance of " + c.name.String()
+        }
+    case Primitive:
+        return "primitive"
+    case *closure:
+        return "closure of " + describe(V{xv.method})
+    }
+    return fmt.Sprintf("%T", x.val)
+}
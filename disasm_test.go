@@ -0,0 +1,60 @@
+package script
+
+import (
+    "testing"
+)
+
+func TestDisassemble(t *testing.T) {
+    u := &Unit{Values: []V{Int(1), String("hi"), V{new(Name).init("foo")}}}
+    code := Code{
+        FRAME, 17,0,
+        GLOBAL, 1,0,0,0, PUSH,
+        GLOBAL, 0,0,0,0,
+        LOOKUP, 2,0,0,0,
+        CALL, 1,
+        BOUND, 0,
+        GLOBAL, 9,0,0,0,
+        RETURN,
+        99,
+        JUMP, 1,
+    }
+    expected := `0000  FRAME    17
+0003  GLOBAL   1	; "hi"
+0008  PUSH
+0009  GLOBAL   0	; 1
+0014  LOOKUP   2	; name foo
+0019  CALL     1
+0021  BOUND    0
+0023  GLOBAL   9	; out of range
+0028  RETURN
+0029  ??? 99
+0030  JUMP     <truncated>
+`
+    if s := Disassemble(code, u); s != expected {
+        t.Errorf("unexpected listing:\n%s", s)
+    }
+}
+
+func TestDisassembleUnit(t *testing.T) {
+    host := New()
+    u := &Unit{}
+    name := new(Name).init("first")
+    m := newMethod(name, 1, Code{BOUND, 0, RETURN}, u)
+    object := host.builtins.classes.Object.val.(*class)
+    u.Values = []V{
+        V{name},
+        V{m},
+        V{newClass(new(Name).init("Test"), object, []*Name{name}, []V{V{m}})},
+    }
+    expected := `0: name first
+1: method first/1
+    0000  BOUND    0
+    0002  RETURN
+2: class Test
+    0: getSlot = primitive
+    1: first = method first/1
+`
+    if s := DisassembleUnit(u); s != expected {
+        t.Errorf("unexpected listing:\n%s", s)
+    }
+}
@@ -0,0 +1,99 @@
+package script
+
+import (
+    "fmt"
+    "strings"
+)
+
+// Returned from running a process when it throws a value that nothing catches.
+type ScriptError struct {
+    Value V
+    Trace []TraceEntry
+}
+
+// A call that was in progress when a value was thrown. Traces list the
+// innermost call first.
+type TraceEntry struct {
+    Method string
+    Pos int
+}
+
+func (e *ScriptError) Error() string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "uncaught exception: %v", e.Value.val)
+    for _, t := range e.Trace {
+        fmt.Fprintf(&b, "\n\tat %s+%d", t.Method, t.Pos)
+    }
+    return b.String()
+}
+
+func (f *frame) traceEntry() TraceEntry {
+    name := "?"
+    if f.method != nil && f.method.name != nil {
+        name = f.method.name.String()
+    }
+    return TraceEntry{name, f.pos}
+}
+
+func (p *Process) backtrace() []TraceEntry {
+    trace := []TraceEntry{p.frame.traceEntry()}
+    for i := len(p.control)-1; i >= 0; i-- {
+        trace = append(trace, p.control[i].traceEntry())
+    }
+    return trace
+}
+
+func (p *Process) throwError(msg string) {
+    p.throw(String(msg))
+}
+
+// Unwind the control stack to the nearest frame with a handler installed and
+// call the handler with the thrown value. The handler is removed before it is
+// called, so anything it throws goes further up the stack. Whatever it returns
+// is returned in place of the call that threw.
+//
+// If the frame that threw catches the value then the handler returns to the
+// next instruction. The stacks are first put back as that instruction would
+// have found them had nothing been thrown, which is what the verifier expects,
+// rather than left as a call abandoned part of the way through left them.
+//
+// If there is no handler then the process fails.
+func (p *Process) throw(x V) {
+    trace := p.backtrace()
+    own := true
+    for p.handler.val == nil {
+        if len(p.control) == 0 {
+            p.err = &ScriptError{x, trace}
+            p.status = failed
+            return
+        }
+        p.leave()
+        own = false
+    }
+    if own {
+        p.stack = p.stack[:p.markStack]
+        p.control = p.control[:p.markControl]
+    }
+    handler := p.handler
+    p.handler = V{}
+    p.enter()
+    p.push(x)
+    p.result = p.this
+    p.slot = handler
+    p.call(1, false)
+}
+
+// Go panics while running, e.g. from malformed code, are thrown as script
+// exceptions rather than taking down the host.
+func (p *Process) runProtected() {
+    p.protect(p.run)
+}
+
+func (p *Process) protect(fn func()) {
+    defer func() {
+        if r := recover(); r != nil {
+            p.throwError(fmt.Sprint(r))
+        }
+    }()
+    fn()
+}
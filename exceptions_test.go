@@ -0,0 +1,100 @@
+package script
+
+import (
+    "testing"
+    "strings"
+)
+
+func TestThrow(t *testing.T) {
+    host := New()
+    u := &Unit{}
+    meth := func(name string, argc int, code Code) V {
+        return V{newMethod(new(Name).init(name), argc, code, u)}
+    }
+    u.Values = []V{
+        String("boom"),
+        V{},
+        meth("catch", 1, Code{GLOBAL, 3,0,0,0, RETURN}),
+        String("caught"),
+        meth("rethrow", 1, Code{BOUND, 0, THROW}),
+        // 5: uncaught
+        meth("main", 0, Code{GLOBAL, 0,0,0,0, THROW}),
+        // 6: caught in the same frame
+        meth("main", 0, Code{GLOBAL, 2,0,0,0, HANDLE, GLOBAL, 0,0,0,0, THROW, RETURN}),
+        // 7: caught further up the control stack
+        meth("main", 0, Code{
+            GLOBAL, 2,0,0,0, HANDLE,
+            FRAME, 21,0,
+            GLOBAL, 1,0,0,0, HANDLE,
+            GLOBAL, 0,0,0,0, THROW,
+            RETURN,
+        }),
+        // 8: the handler throws
+        meth("main", 0, Code{GLOBAL, 4,0,0,0, HANDLE, GLOBAL, 0,0,0,0, THROW, RETURN}),
+        // 9: a call that fails part of the way through leaves its arguments
+        meth("main", 0, Code{
+            GLOBAL, 2,0,0,0, HANDLE,
+            GLOBAL, 0,0,0,0, PUSH,
+            CALL, 1,
+            PUSH, BOUND, 1, RETURN,
+        }),
+        // 10: a closure that fails takes its free variables
+        meth("main", 0, Code{
+            GLOBAL, 2,0,0,0, HANDLE,
+            GLOBAL, 0,0,0,0, PUSH, PUSH,
+            CLOSURE, 2,
+            PUSH, BOUND, 0, RETURN,
+        }),
+    }
+    for i, test := range ([]struct{entry int; result, thrown V; trace []TraceEntry}{
+        {5, V{}, String("boom"), []TraceEntry{{"main", 6}}},
+        {6, String("caught"), V{}, nil},
+        {7, String("caught"), V{}, nil},
+        {8, V{}, String("boom"), []TraceEntry{{"rethrow", 3}, {"main", 12}}},
+        {9, String("caught"), V{}, nil},
+        {10, String("caught"), V{}, nil},
+    }) {
+        result, err := host.Run(u, test.entry, V{})
+        if test.thrown.val == nil {
+            if err != nil {
+                t.Errorf("[%d]: unexpected error %v", i, err)
+            }
+            if result != test.result {
+                t.Errorf("[%d]: %#v != %#v", i, result, test.result)
+            }
+            continue
+        }
+        serr, ok := err.(*ScriptError)
+        if !ok {
+            t.Errorf("[%d]: expected a script error, got %v", i, err)
+            continue
+        }
+        if serr.Value != test.thrown {
+            t.Errorf("[%d]: thrown %#v != %#v", i, serr.Value, test.thrown)
+        }
+        if len(serr.Trace) != len(test.trace) {
+            t.Errorf("[%d]: trace %v != %v", i, serr.Trace, test.trace)
+            continue
+        }
+        for j := range test.trace {
+            if serr.Trace[j] != test.trace[j] {
+                t.Errorf("[%d]: trace %v != %v", i, serr.Trace, test.trace)
+            }
+        }
+    }
+}
+
+func TestPanicThrows(t *testing.T) {
+    host := New()
+    u := &Unit{}
+    u.Values = []V{V{newMethod(nil, 0, Code{BOUND, 5, RETURN}, u)}}
+    _, err := host.Run(u, 0, V{})
+    serr, ok := err.(*ScriptError)
+    if !ok {
+        t.Fatalf("expected a script error, got %v", err)
+    }
+    msg, _ := serr.Value.AsString()
+    if !strings.Contains(msg, "index out of range") {
+        t.Errorf("unexpected message %q", msg)
+    }
+}
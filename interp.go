@@ -1,33 +1,84 @@
 package script
 
-import ()
+import (
+    "errors"
+    "sync"
+)
 
+// An Interpreter holds the classes, names and packages that processes share.
+// Any number of goroutines may use one Interpreter at once, each running its
+// own Processes, and classes may be extended while they run. A Process must
+// only be used by one goroutine at a time. Objects and arrays are not
+// synchronised, so processes that share them have to coordinate.
 type Interpreter struct {
     builtins builtins
     packageRoot V
     names map[string]*Name
+    namesLock sync.Mutex
+    packagesLock sync.Mutex
+    source PackageSource
+    verifyImports bool
+    importing []*Name
+    loaded map[*Name]bool
+    // Every package object, which are kept apart from other package members.
+    packages map[*Name]V
+    cacheHits, cacheMisses uint64
 }
 
 type Code []byte
 
-type unit struct {
+// The constants used by a body of code. GLOBAL instructions index into Values.
+// A unit loaded from an image has one value per item in the image.
+type Unit struct {
     Values []V
+    // The package the code belongs to, which decides the package-private
+    // members it can see. Nil for code outside any package.
+    Package *Name
+}
+
+// A block of code that can be called as a method.
+type method struct {
+    name *Name
+    argc int
+    code Code
+    unit *Unit
+    // The lookup cache for each LOOKUP instruction, in order of position.
+    sites []lookupSite
+    sitePos []int
+}
+
+func newMethod(name *Name, argc int, code Code, u *Unit) *method {
+    m := &method{name: name, argc: argc, code: code, unit: u}
+    m.findSites()
+    return m
 }
 
 type Process struct {
     host *Interpreter
     result V
+    status int
+    err error
     frame
     control []frame
+    // Set while a Scheduler runs the process. A budget of zero is unlimited.
+    thread *Thread
+    budget int
+    // The depths of the stack and the control stack that the next instruction
+    // starts with if the current one throws a value that its own frame
+    // catches.
+    markStack, markControl int
+    // Lookup cache counts not yet added to the interpreter's.
+    cacheHits, cacheMisses uint64
 }
 
 type frame struct {
     this, slot, handler V
     argc, pos, base int
+    method *method
     code Code
     closure []V
     stack []V
-    unit *unit
+    unit *Unit
 }
 
 func New() *Interpreter {
@@ -35,9 +86,88 @@ func New() *Interpreter {
 }
 
 func (host *Interpreter) init() *Interpreter {
+    host.names = map[string]*Name{}
+    host.loaded = map[*Name]bool{}
+    host.packages = map[*Name]V{}
+    host.initBuiltins()
+    host.packageRoot = host.newPackage(host.Intern("root"))
+    host.initThreads()
     return host
 }
 
+var (
+    ErrNotMethod = errors.New("entry point is not a method")
+    ErrArity = errors.New("wrong number of arguments")
+    ErrSuspended = errors.New("process is suspended")
+    ErrNotSuspended = errors.New("process is not suspended")
+)
+
+// Prepare a process that will call the method at index entry in the unit's
+// values with the given receiver and arguments. The process does not start
+// until it is run.
+func (host *Interpreter) Spawn(u *Unit, entry int, this V, args ...V) (*Process, error) {
+    if entry < 0 || entry >= len(u.Values) {
+        return nil, ErrNotMethod
+    }
+    m, ok := u.Values[entry].val.(*method)
+    if !ok {
+        return nil, ErrNotMethod
+    }
+    if len(args) != m.argc {
+        return nil, ErrArity
+    }
+    p := &Process{host: host}
+    p.stack = append([]V(nil), args...)
+    p.start(m, this, len(args))
+    return p, nil
+}
+
+// Spawn a process and run it to completion.
+func (host *Interpreter) Run(u *Unit, entry int, this V, args ...V) (V, error) {
+    p, err := host.Spawn(u, entry, this, args...)
+    if err != nil {
+        return V{}, err
+    }
+    return p.Run()
+}
+
+// Run the process until it finishes and return the result. If the process
+// throws a value that it does not catch then the error is a *ScriptError.
+// Running a process that has already finished returns the same result again.
+//
+// If a primitive suspends the process then Run returns ErrSuspended, and the
+// process can be continued with Resume.
+func (p *Process) Run() (V, error) {
+    for p.status == running {
+        p.runProtected()
+    }
+    p.flushCacheStats()
+    if p.status == suspended {
+        return V{}, ErrSuspended
+    }
+    return p.result, p.err
+}
+
+// Continue running a suspended process. The primitive that suspended it returns
+// x to its caller.
+func (p *Process) Resume(x V) (V, error) {
+    if p.status != suspended {
+        return V{}, ErrNotSuspended
+    }
+    p.status = running
+    p.result = x
+    p.leave()
+    return p.Run()
+}
+
+const (
+    running = iota
+    finished
+    failed
+    suspended
+    preempted
+)
+
 const (
     HALT = iota
     THIS
@@ -55,13 +185,23 @@ const (
     TCALL
     FRAME
     RETURN
+    THROW
+    HANDLE
+    CELL
+    LOAD
+    STORE
+    CLOSURE
+    // Only used by frames that call back into primitives.
+    RESUME
 )
 
 func (p *Process) run() {
-    for {
+    p.status = running
+    for p.status == running {
+        p.markStack, p.markControl = len(p.stack), len(p.control)
         switch p.nextByte() {
         case HALT:
-            return
+            p.status = finished
         case THIS:
             p.result = p.this
         case BOUND:
@@ -69,7 +209,11 @@ func (p *Process) run() {
             p.result = p.stack[p.base + n]
         case FREE:
             n := p.next2Bytes()
-            p.result = p.stack[n]
+            if n >= len(p.closure) {
+                p.throwError("no such free variable")
+                break
+            }
+            p.result = p.closure[n]
         case GLOBAL:
             id := p.next4Bytes()
             p.result = p.unit.Values[id]
@@ -84,14 +228,15 @@ func (p *Process) run() {
         case PUSH:
             p.push(p.result)
         case LOOKUP:
+            site := p.pos - 1
             id := p.next4Bytes()
             name := p.unit.Values[id]
-            p.lookup(name)
+            p.cachedLookup(site, name)
         case GET:
             p.get(false)
         case SET:
             val := p.pop()
-            p.result = V{nil}
+            p.markStack--
             p.set(val)
         case CALL:
             argc := p.nextByte()
@@ -103,10 +248,46 @@ func (p *Process) run() {
             p.call(argc, true)
         case FRAME:
             loc := p.next2Bytes()
+            pos := p.pos
             p.pos = loc
             p.enter()
+            p.pos = pos
         case RETURN:
             p.leave()
+        case THROW:
+            p.throw(p.result)
+        case HANDLE:
+            p.handler = p.result
+        case CELL:
+            n := p.nextByte()
+            p.stack[p.base + n] = V{&cell{p.stack[p.base + n]}}
+        case LOAD:
+            if c, ok := p.result.val.(*cell); ok {
+                p.result = c.value
+            } else {
+                p.throwError("not a cell")
+            }
+        case STORE:
+            val := p.pop()
+            p.markStack--
+            if c, ok := p.result.val.(*cell); ok {
+                c.value = val
+                p.result = V{}
+            } else {
+                p.throwError("not a cell")
+            }
+        case CLOSURE:
+            n := p.nextByte()
+            p.markStack -= n
+            p.makeClosure(n)
+        case RESUME:
+            p.resume()
+        }
+        if p.budget > 0 {
+            p.budget--
+            if p.budget == 0 && p.status == running {
+                p.status = preempted
+            }
         }
     }
 }
@@ -144,76 +325,124 @@ func (p *Process) enter() {
     p.control = append(p.control, p.frame)
 }
 
+// Enter a method, the arguments to which are on top of the stack.
+func (p *Process) start(m *method, this V, argc int) {
+    p.this = this
+    p.slot = V{}
+    p.handler = V{}
+    p.argc = argc
+    p.base = len(p.stack) - argc
+    p.pos = 0
+    p.method = m
+    p.code = m.code
+    p.closure = nil
+    p.unit = m.unit
+}
+
+// Returning from the outermost frame finishes the process.
 func (p *Process) leave() {
+    if len(p.control) == 0 {
+        p.status = finished
+        return
+    }
     end := len(p.control)-1
     p.frame = p.control[end]
     p.control = p.control[:end]
 }
 
-func (p *Process) lookup(nm V) {
+// Find the slot for a member of the current result. If this fails then an
+// exception has been thrown and the caller should stop what it is doing.
+func (p *Process) lookup(nm V) bool {
     nmv, ok := nm.val.(*Name)
     if !ok {
-        p.throw("name wrong type")
-        return
+        p.throwError("name wrong type")
+        return false
+    }
+    if !p.canSee(nmv) {
+        p.throwError(nmv.String() + ": member is private")
+        return false
     }
     cls := p.host.ClassOf(p.result)
     bcls, ok := cls.val.(*class)
     if ok {
         slot, err := bcls.lookup(nmv)
         if err != nil {
-            p.throw(err.Error())
+            p.throwError(err.Error())
+            return false
         }
         p.slot = slot
-        return
+        return true
     }
     p.push(p.result)
     p.enter()
     p.push(nm)
     p.result = cls
-    p.lookup(p.host.builtins.names.lookup)
+    if !p.lookup(p.host.builtins.names.lookup) {
+        return false
+    }
     p.slot = p.result
     p.result = p.pop()
+    return true
 }
 
+// Find the value of a field slot in the current result.
 func (p *Process) getFieldOffset() (*V, bool) {
     offset, ok := p.slot.val.(*UserObject).fields[0].AsInt()
     if !ok {
-        p.throw("unexpected field offset type")
+        p.throwError("unexpected field offset type")
         return nil, false
     }
-    obj, ok := p.this.AsObject()
+    obj, ok := p.result.AsObject()
     if !ok {
-        p.throw("unexpected target type")
+        p.throwError("unexpected target type")
+        return nil, false
+    }
+    if offset < 0 || int(offset) >= len(obj.fields) {
+        p.throwError("object does not have the field")
         return nil, false
     }
     return &obj.fields[offset], true
 }
 
+// Fields are read directly. Anything else is asked for its value by calling its
+// getSlot member with the receiver.
 func (p *Process) get(tail bool) {
     if p.host.ClassOf(p.slot) == p.host.builtins.classes.Field {
         if field, ok := p.getFieldOffset(); ok {
             p.result = *field
+            if tail {
+                p.leave()
+            }
         }
+        return
     }
     if !tail {
         p.enter()
     }
     p.push(p.result)
-    p.lookup(p.host.builtins.names.getSlot)
-    p.call(1, tail)
+    p.result = p.slot
+    if p.lookup(p.host.builtins.names.getSlot) {
+        p.call(1, tail)
+    }
 }
 
+// Fields are written directly. Anything else is updated by calling its setSlot
+// member with the new value and the receiver. Either way, the result is nil.
 func (p *Process) set(val V) {
     if p.host.ClassOf(p.slot) == p.host.builtins.classes.Field {
         if field, ok := p.getFieldOffset(); ok {
             *field = val
+            p.result = V{}
         }
+        return
     }
     p.enter()
     p.push(val)
     p.push(p.result)
-    p.lookup(p.host.builtins.names.setSlot)
-    p.call(2, false)
+    p.result = p.slot
+    if p.lookup(p.host.builtins.names.setSlot) {
+        p.call(2, false)
+    }
 }
 
 func (p *Process) call(argc int, tail bool) {
@@ -222,7 +451,9 @@ func (p *Process) call(argc int, tail bool) {
         p.push(p.result)
         p.result = p.slot
         argc++
-        p.lookup(calln)
+        if !p.lookup(calln) {
+            return
+        }
     }
 }
 
@@ -233,9 +464,9 @@ func (p *Process) callPrimitive(argc int, tail bool) bool {
     if tail {
         p.shuffle(argc)
     }
-    fn, ok := p.result.val.(Primitive)
+    fn, ok := p.slot.val.(Primitive)
     if !ok {
-        p.throw("unexpected primitive method type")
+        p.throwError("unexpected primitive method type")
         return true
     }
     p.argc = argc
@@ -252,8 +483,4 @@ func (p *Process) shuffle(argc int) {
     p.stack = p.stack[:dest+argc]
 }
 
-func (p *Process) throw(e string) {
-    panic(e)
-}
-
 
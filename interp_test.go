@@ -63,7 +63,7 @@ func TestCode1(t *testing.T) {
         {[]V{Int(1)}, Code{4, 0,0,0,0, 0}, Int(1)},
     }) {
         p := new(Process)
-        p.unit = &unit{test.unit}
+        p.unit = &Unit{Values: test.unit}
         p.code = test.code
         p.run()
         if p.result != test.result {
@@ -76,3 +76,56 @@ func TestCode1(t *testing.T) {
 
 
 
+
+func TestSpawn(t *testing.T) {
+    host := New()
+    u := &Unit{}
+    u.Values = []V{
+        Int(1),
+        V{newMethod(nil, 0, Code{GLOBAL, 0,0,0,0, RETURN}, u)},
+        V{newMethod(nil, 2, Code{BOUND, 1, RETURN}, u)},
+        V{newMethod(nil, 0, Code{THIS, HALT}, u)},
+    }
+    for i, test := range ([]struct{entry int; this V; args []V; result V; err error}{
+        {1, V{}, nil, Int(1), nil},
+        {2, V{}, []V{Int(2), Int(3)}, Int(3), nil},
+        {3, String("this"), nil, String("this"), nil},
+        {0, V{}, nil, V{}, ErrNotMethod},
+        {4, V{}, nil, V{}, ErrNotMethod},
+        {2, V{}, []V{Int(2)}, V{}, ErrArity},
+    }) {
+        result, err := host.Run(u, test.entry, test.this, test.args...)
+        if err != test.err {
+            t.Errorf("[%d]: unexpected error %v", i, err)
+        }
+        if result != test.result {
+            t.Errorf("[%d]: %#v != %#v", i, result, test.result)
+        }
+    }
+}
+
+func TestIntern(t *testing.T) {
+    host := New()
+    names := make([]*Name, 8)
+    done := make(chan bool)
+    for i := range names {
+        go func(i int) {
+            names[i] = host.Intern("shared")
+            done <- true
+        }(i)
+    }
+    for range names {
+        <-done
+    }
+    for i, n := range names {
+        if n != names[0] {
+            t.Errorf("[%d]: different name", i)
+        }
+    }
+    if host.Intern("other") == names[0] {
+        t.Error("different strings share a name")
+    }
+    if host.Intern("lookup") != host.builtins.names.lookup.val.(*Name) {
+        t.Error("builtin names are not interned")
+    }
+}
@@ -0,0 +1,252 @@
+package script
+
+import (
+    "io"
+
+    "github.com/bobappleyard/script/bytecode"
+)
+
+// The compound items that may appear in an image, in addition to the atomic
+// items defined by the bytecode package. Int, Float and Bytes items are loaded
+// as Int, Float and String values respectively.
+const (
+    // [Bytes]: the name of an object member.
+    NameType bytecode.TypeId = iota + 3
+    // [Name, Bytes, Int]: a method's name, code and number of arguments.
+    MethodType
+    // [Name]: a field declaration, for use in classes.
+    FieldType
+    // [Name, ancestor, member...]: a class. The ancestor is a class or an
+    // Object item, and the members are methods and fields.
+    ClassType
+    // [Name]: the path of the package the image belongs to. An image declares
+    // at most one package.
+    PackageType
+    // [Name, value]: a member of the image's package.
+    ExportType
+    // [Name]: the package with the given path, which is imported if it has not
+    // been already.
+    ImportType
+    // []: the Object class, for classes that derive from nothing else.
+    ObjectType
+)
+
+type imageLayout struct{}
+
+// The layout of script images, for use with bytecode.NewWriter.
+var ImageLayout bytecode.Layout = imageLayout{}
+
+func (imageLayout) CompoundSize(id bytecode.TypeId) (int, error) {
+    switch id {
+    case ObjectType:
+        return 0, nil
+    case NameType, FieldType, PackageType, ImportType:
+        return 1, nil
+    case ExportType:
+        return 2, nil
+    case MethodType:
+        return 3, nil
+    case ClassType:
+        return -1, nil
+    }
+    return 0, bytecode.ErrUnknownSection
+}
+
+// Read an image and prepare it to be run. If the image declares a package then
+// its exports are linked into the package, and any packages it imports are
+// imported first.
+func (host *Interpreter) Load(input io.Reader) (*Unit, error) {
+    host.packagesLock.Lock()
+    defer host.packagesLock.Unlock()
+    return host.load(input)
+}
+
+func (host *Interpreter) load(input io.Reader) (*Unit, error) {
+    l, err := host.decode(input)
+    if err != nil {
+        return nil, err
+    }
+    return l.link()
+}
+
+// Read an image without linking it into its package, so that the caller can
+// check it first.
+func (host *Interpreter) decode(input io.Reader) (*loader, error) {
+    l := &loader{host: host, unit: new(Unit)}
+    defer host.leavePackage(len(host.importing))
+    if err := bytecode.ReadImage(input, l); err != nil {
+        return nil, err
+    }
+    return l, nil
+}
+
+// Read an image without importing the packages it needs or linking it into its
+// package, for tools that only look at images. Each import gets a package
+// object of its own outside the package tree, so the unit is not fit to run.
+func (host *Interpreter) Decode(input io.Reader) (*Unit, error) {
+    l := &loader{host: host, unit: new(Unit), detached: true}
+    if err := bytecode.ReadImage(input, l); err != nil {
+        return nil, err
+    }
+    return l.unit, nil
+}
+
+func (l *loader) link() (*Unit, error) {
+    if err := l.host.linkPackage(l.unit.Package, l.exports); err != nil {
+        return nil, err
+    }
+    return l.unit, nil
+}
+
+type loader struct {
+    imageLayout
+    host *Interpreter
+    unit *Unit
+    exports []export
+    // Set when decoding without touching the interpreter's packages.
+    detached bool
+}
+
+type export struct {
+    name *Name
+    value V
+}
+
+func (l *loader) add(x V) error {
+    l.unit.Values = append(l.unit.Values, x)
+    return nil
+}
+
+func (l *loader) Int(x int64) error {
+    return l.add(Int(x))
+}
+
+func (l *loader) Float(x float64) error {
+    return l.add(Float(x))
+}
+
+func (l *loader) Bytes(bs []byte) error {
+    return l.add(String(string(bs)))
+}
+
+func (l *loader) Compound(id bytecode.TypeId, items []bytecode.ItemId) error {
+    vs := make([]V, len(items))
+    for i, item := range items {
+        if int(item) >= len(l.unit.Values) {
+            return bytecode.ErrInvalidEntry
+        }
+        vs[i] = l.unit.Values[item]
+    }
+    switch id {
+    case NameType:
+        return l.loadName(vs)
+    case MethodType:
+        return l.loadMethod(vs)
+    case FieldType:
+        return l.loadField(vs)
+    case ClassType:
+        return l.loadClass(vs)
+    case PackageType:
+        return l.loadPackage(vs)
+    case ExportType:
+        return l.loadExport(vs)
+    case ImportType:
+        return l.loadImport(vs)
+    case ObjectType:
+        return l.add(l.host.builtins.classes.Object)
+    }
+    return bytecode.ErrUnknownSection
+}
+
+func (l *loader) loadName(vs []V) error {
+    str, ok := vs[0].AsString()
+    if !ok {
+        return bytecode.ErrInvalidEntry
+    }
+    return l.add(V{l.host.Intern(str)})
+}
+
+func (l *loader) loadMethod(vs []V) error {
+    name, nameOk := vs[0].val.(*Name)
+    code, codeOk := vs[1].AsString()
+    argc, argcOk := vs[2].AsInt()
+    if !(nameOk && codeOk && argcOk) || argc < 0 || argc > 255 {
+        return bytecode.ErrInvalidEntry
+    }
+    return l.add(V{newMethod(name, int(argc), Code(code), l.unit)})
+}
+
+func (l *loader) loadField(vs []V) error {
+    name, ok := vs[0].val.(*Name)
+    if !ok {
+        return bytecode.ErrInvalidEntry
+    }
+    return l.add(V{&fieldDecl{name}})
+}
+
+func (l *loader) loadClass(vs []V) error {
+    if len(vs) < 2 {
+        return bytecode.ErrInvalidEntry
+    }
+    name, ok := vs[0].val.(*Name)
+    if !ok {
+        return bytecode.ErrInvalidEntry
+    }
+    ancestor, ok := vs[1].val.(*class)
+    if !ok {
+        return bytecode.ErrInvalidEntry
+    }
+    members := vs[2:]
+    names := make([]*Name, len(members))
+    for i, m := range members {
+        switch mv := m.val.(type) {
+        case *method:
+            names[i] = mv.name
+        case *fieldDecl:
+            names[i] = mv.name
+        default:
+            return bytecode.ErrInvalidEntry
+        }
+    }
+    return l.add(V{l.host.makeClass(name, ancestor, names, members)})
+}
+
+func (l *loader) loadPackage(vs []V) error {
+    path, ok := vs[0].val.(*Name)
+    if !ok || l.unit.Package != nil {
+        return bytecode.ErrInvalidEntry
+    }
+    if l.detached {
+        l.unit.Package = path
+        return l.add(V{path})
+    }
+    if err := l.host.enterPackage(path); err != nil {
+        return err
+    }
+    l.unit.Package = path
+    return l.add(V{path})
+}
+
+func (l *loader) loadExport(vs []V) error {
+    name, ok := vs[0].val.(*Name)
+    if !ok || l.unit.Package == nil {
+        return bytecode.ErrInvalidEntry
+    }
+    l.exports = append(l.exports, export{name, vs[1]})
+    return l.add(vs[1])
+}
+
+func (l *loader) loadImport(vs []V) error {
+    path, ok := vs[0].val.(*Name)
+    if !ok {
+        return bytecode.ErrInvalidEntry
+    }
+    if l.detached {
+        return l.add(l.host.newPackage(path))
+    }
+    pkg, err := l.host.importPackage(path)
+    if err != nil {
+        return err
+    }
+    return l.add(pkg)
+}
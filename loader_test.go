@@ -0,0 +1,170 @@
+package script
+
+import (
+    "testing"
+    "bytes"
+    "errors"
+    "strings"
+
+    "github.com/bobappleyard/script/bytecode"
+)
+
+func loadImage(t *testing.T, host *Interpreter, w *bytecode.Writer) (*Unit, error) {
+    buf := new(bytes.Buffer)
+    if _, err := w.WriteTo(buf); err != nil {
+        t.Fatal(err)
+    }
+    return host.Load(buf)
+}
+
+func TestLoadAtoms(t *testing.T) {
+    w := bytecode.NewWriter(ImageLayout)
+    w.Int(42)
+    w.Float(0.5)
+    w.Bytes([]byte("hello"))
+    u, err := loadImage(t, New(), w)
+    if err != nil {
+        t.Fatal(err)
+    }
+    expected := []V{Int(42), Float(0.5), String("hello")}
+    if len(u.Values) != len(expected) {
+        t.Fatalf("wrong number of values: %d", len(u.Values))
+    }
+    for i, v := range expected {
+        if u.Values[i] != v {
+            t.Errorf("[%d]: %#v != %#v", i, u.Values[i], v)
+        }
+    }
+}
+
+func TestLoadClass(t *testing.T) {
+    w := bytecode.NewWriter(ImageLayout)
+    fooName := w.Compound(NameType, w.Bytes([]byte("foo")))
+    barName := w.Compound(NameType, w.Bytes([]byte("bar")))
+    clsName := w.Compound(NameType, w.Bytes([]byte("Test")))
+    m := w.Compound(MethodType, fooName, w.Bytes([]byte{THIS, RETURN}), w.Int(0))
+    f := w.Compound(FieldType, barName)
+    c := w.Compound(ClassType, clsName, w.Compound(ObjectType), m, f)
+    host := New()
+    u, err := loadImage(t, host, w)
+    if err != nil {
+        t.Fatal(err)
+    }
+    mv, ok := u.Values[m].val.(*method)
+    if !ok {
+        t.Fatalf("expected method, got %#v", u.Values[m])
+    }
+    if mv.name.str != "foo" || mv.argc != 0 || string(mv.code) != string(Code{THIS, RETURN}) || mv.unit != u {
+        t.Errorf("unexpected method %#v", mv)
+    }
+    cls, ok := u.Values[c].val.(*class)
+    if !ok {
+        t.Fatalf("expected class, got %#v", u.Values[c])
+    }
+    if cls.name.str != "Test" || cls.ancestor != host.builtins.classes.Object.val {
+        t.Errorf("unexpected class %#v", cls)
+    }
+    foo, _ := cls.lookup(u.Values[fooName].val.(*Name))
+    if foo != u.Values[m] {
+        t.Errorf("foo: %#v != %#v", foo, u.Values[m])
+    }
+    bar, _ := cls.lookup(u.Values[barName].val.(*Name))
+    field, ok := bar.AsObject()
+    if !ok {
+        t.Fatalf("expected field, got %#v", bar)
+    }
+    offset := cls.getMembers().shape.lookup(u.Values[barName].val.(*Name))
+    if field.fields[0] != Int(int64(offset)) {
+        t.Errorf("wrong field offset: %#v != %d", field.fields[0], offset)
+    }
+}
+
+func TestLoadErrors(t *testing.T) {
+    for i, write := range ([]func(w *bytecode.Writer){
+        func(w *bytecode.Writer) {
+            w.Compound(NameType, w.Int(1))
+        },
+        func(w *bytecode.Writer) {
+            n := w.Compound(NameType, w.Bytes([]byte("foo")))
+            w.Compound(MethodType, n, w.Bytes(nil), w.Float(1))
+        },
+        func(w *bytecode.Writer) {
+            n := w.Compound(NameType, w.Bytes([]byte("foo")))
+            w.Compound(ClassType, n, w.Compound(ObjectType), w.Int(1))
+        },
+        func(w *bytecode.Writer) {
+            n := w.Compound(NameType, w.Bytes([]byte("foo")))
+            w.Compound(ClassType, n, n)
+        },
+    }) {
+        w := bytecode.NewWriter(ImageLayout)
+        write(w)
+        if _, err := loadImage(t, New(), w); err != bytecode.ErrInvalidEntry {
+            t.Errorf("[%d]: unexpected error %v", i, err)
+        }
+    }
+}
+
+func TestLoadSelfReference(t *testing.T) {
+    // A name whose string is the name itself.
+    image := "\x00SCR\x01\x00\x00\x00\x05\x00\x00\x00" + string([]byte{byte(NameType)}) + "\x00\x00\x00\x00"
+    if _, err := New().Load(strings.NewReader(image)); err != bytecode.ErrInvalidEntry {
+        t.Errorf("unexpected error %v", err)
+    }
+}
+
+func TestLoadSharedNames(t *testing.T) {
+    host := New()
+    lib, a := assembleUnit(t, host, `
+        .class Counter
+        .field count
+        .method get 0
+            THIS
+            LOOKUP count
+            TGET
+        .end
+    `)
+    main, b := assembleUnit(t, host, `
+        .method main 1
+            BOUND 0
+            LOOKUP get
+            TCALL 0
+    `)
+    counter, _ := a.Entry("Counter")
+    obj, err := host.New(lib.Values[counter], Int(3))
+    if err != nil {
+        t.Fatal(err)
+    }
+    entry, _ := b.Entry("main")
+    result, err := host.Run(main, entry, V{}, obj)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if result != Int(3) {
+        t.Errorf("%#v != 3", result)
+    }
+}
+
+func TestDecode(t *testing.T) {
+    w := bytecode.NewWriter(ImageLayout)
+    w.Compound(PackageType, w.Compound(NameType, w.Bytes([]byte("app"))))
+    lib := w.Compound(ImportType, w.Compound(NameType, w.Bytes([]byte("lib"))))
+    buf := new(bytes.Buffer)
+    if _, err := w.WriteTo(buf); err != nil {
+        t.Fatal(err)
+    }
+    host := New()
+    u, err := host.Decode(buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if d := describe(u.Values[lib]); d != "instance of lib" {
+        t.Errorf("import is %s", d)
+    }
+    // Nothing was imported or linked.
+    for _, path := range []string{"lib", "app"} {
+        if _, err := host.Import(path); !errors.Is(err, ErrNoPackage) {
+            t.Errorf("%s: unexpected error %v", path, err)
+        }
+    }
+}
@@ -0,0 +1,88 @@
+package script
+
+import (
+    "strings"
+)
+
+// Find the Name for a string. Every call with the same string returns the same
+// Name, so members declared and looked up in different places match.
+//
+// Names may be qualified by another name, usually that of a package or a class,
+// by joining them with dots. The Name for "a.b.size" has the string "size" and
+// the parent "a.b". This lets two libraries each define a "size" member without
+// clashing.
+//
+// Looking up a qualified name that is not defined falls back to the same name
+// with its innermost qualifier removed, so "a.b.size" falls back to "a.size"
+// and then to "size". Private names do not fall back.
+//
+// Names whose last part starts with an underscore are private to their
+// qualifier. An unqualified private name can only be looked up on the receiver
+// of the current method, and a qualified one only by code in the package named
+// by the qualifier or a package within it.
+func (host *Interpreter) Intern(str string) *Name {
+    host.namesLock.Lock()
+    defer host.namesLock.Unlock()
+    return host.intern(str)
+}
+
+func (host *Interpreter) intern(str string) *Name {
+    if n, ok := host.names[str]; ok {
+        return n
+    }
+    n := new(Name)
+    if dot := strings.LastIndex(str, "."); dot != -1 {
+        n.init(str[dot+1:])
+        n.parent = host.intern(str[:dot])
+        switch {
+        case n.private():
+        case n.parent.parent != nil:
+            n.fallback = host.intern(n.parent.parent.String() + "." + n.str)
+        default:
+            n.fallback = host.intern(n.str)
+        }
+    } else {
+        n.init(str)
+    }
+    host.names[str] = n
+    return n
+}
+
+// The full, qualified form of the name.
+func (n *Name) String() string {
+    if n.parent == nil {
+        return n.str
+    }
+    return n.parent.String() + "." + n.str
+}
+
+func (n *Name) private() bool {
+    return strings.HasPrefix(n.str, "_")
+}
+
+// Whether the current code may look n up on the current result.
+func (p *Process) canSee(n *Name) bool {
+    if !n.private() {
+        return true
+    }
+    if n.parent == nil {
+        return sameObject(p.result, p.this)
+    }
+    if p.unit == nil {
+        return false
+    }
+    for pkg := p.unit.Package; pkg != nil; pkg = pkg.parent {
+        if pkg == n.parent {
+            return true
+        }
+    }
+    return false
+}
+
+func sameObject(x, y V) bool {
+    switch x.val.(type) {
+    case Primitive, Continuation:
+        return false
+    }
+    return x == y
+}
@@ -0,0 +1,94 @@
+package script
+
+import (
+    "testing"
+)
+
+func TestQualifiedNames(t *testing.T) {
+    host := New()
+    n := host.Intern("a.b.size")
+    if n.str != "size" || n.parent != host.Intern("a.b") || n.String() != "a.b.size" {
+        t.Errorf("unexpected name %#v", n)
+    }
+    if n.fallback != host.Intern("a.size") || n.fallback.fallback != host.Intern("size") {
+        t.Error("wrong fallback")
+    }
+    if host.Intern("a._size").fallback != nil {
+        t.Error("private names should not fall back")
+    }
+}
+
+func TestMemberVisibility(t *testing.T) {
+    host := New()
+    u, a := assembleUnit(t, host, `
+        .class Shape
+        .field _secret
+        .field lib._hidden
+        .method size 0
+            GLOBAL 1
+            RETURN
+        .method lib.size 0
+            GLOBAL 2
+            RETURN
+        .method peek 0
+            THIS
+            LOOKUP _secret
+            TGET
+        .end
+
+        .method libSize 1
+            BOUND 0
+            LOOKUP "lib.sub.size"
+            TCALL 0
+        .method otherSize 1
+            BOUND 0
+            LOOKUP other.size
+            TCALL 0
+        .method peek 1
+            BOUND 0
+            LOOKUP peek
+            TCALL 0
+        .method secret 1
+            BOUND 0
+            LOOKUP _secret
+            TGET
+        .method hidden 1
+            BOUND 0
+            LOOKUP lib._hidden
+            TGET
+    `)
+    shape, _ := a.Entry("Shape")
+    obj, err := host.New(u.Values[shape], String("s"), String("h"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    for i, test := range ([]struct{entry, pkg string; result V; err string}{
+        {"libSize", "", Int(2), ""},
+        {"otherSize", "", Int(1), ""},
+        {"peek", "", String("s"), ""},
+        {"secret", "", V{}, "_secret: member is private"},
+        {"hidden", "", V{}, "lib._hidden: member is private"},
+        {"hidden", "other", V{}, "lib._hidden: member is private"},
+        {"hidden", "lib", String("h"), ""},
+        {"hidden", "lib.sub", String("h"), ""},
+    }) {
+        u.Package = nil
+        if test.pkg != "" {
+            u.Package = host.Intern(test.pkg)
+        }
+        entry, _ := a.Entry(test.entry)
+        result, err := host.Run(u, entry, V{}, obj)
+        if test.err != "" {
+            if serr, ok := err.(*ScriptError); !ok || serr.Value != String(test.err) {
+                t.Errorf("[%d]: unexpected error %v", i, err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("[%d]: unexpected error %v", i, err)
+        }
+        if result != test.result {
+            t.Errorf("[%d]: %#v != %#v", i, result, test.result)
+        }
+    }
+}
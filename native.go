@@ -0,0 +1,187 @@
+package script
+
+import (
+    "errors"
+    "fmt"
+    "reflect"
+)
+
+var (
+    ErrNotClass = errors.New("not a class")
+    ErrNotFunc = errors.New("primitive must be a function")
+)
+
+// Add a member to a class, or replace the member with that name.
+func (host *Interpreter) Define(cls V, name string, x V) error {
+    c, ok := cls.val.(*class)
+    if !ok {
+        return ErrNotClass
+    }
+    c.define(host.Intern(name), x)
+    return nil
+}
+
+// Define a member of a class that calls a Go function. The function's first
+// parameter receives the receiver and the rest receive the arguments. It may
+// also take a *Process before the receiver.
+//
+// Parameters and results can be V, int, int64, float64, string or bool, and
+// are converted to and from script values. The function may return nothing, a
+// value, an error or a value and an error. Returning a non-nil error throws
+// its message.
+//
+// When the primitive is called with the wrong number of arguments, or with
+// arguments that cannot be converted, it throws rather than calling fn.
+func (host *Interpreter) DefinePrimitive(cls V, name string, fn interface{}) error {
+    prim, err := nativePrimitive(fn)
+    if err != nil {
+        return fmt.Errorf("%s: %w", name, err)
+    }
+    return host.Define(cls, name, V{prim})
+}
+
+var (
+    vType = reflect.TypeOf(V{})
+    errorType = reflect.TypeOf((*error)(nil)).Elem()
+    processType = reflect.TypeOf((*Process)(nil))
+)
+
+func nativePrimitive(fn interface{}) (Primitive, error) {
+    f := reflect.ValueOf(fn)
+    if !f.IsValid() || f.Kind() != reflect.Func || f.IsNil() {
+        return nil, ErrNotFunc
+    }
+    t := f.Type()
+    if t.IsVariadic() {
+        return nil, ErrNotFunc
+    }
+    withProcess := t.NumIn() > 0 && t.In(0) == processType
+    var params []reflect.Type
+    for i := 0; i < t.NumIn(); i++ {
+        if i == 0 && withProcess {
+            continue
+        }
+        params = append(params, t.In(i))
+    }
+    if len(params) == 0 {
+        return nil, errors.New("primitive must take a receiver")
+    }
+    for _, p := range params {
+        if !convertible(p) {
+            return nil, fmt.Errorf("unsupported parameter type %s", p)
+        }
+    }
+    hasValue, hasErr := false, false
+    switch t.NumOut() {
+    case 0:
+    case 1:
+        hasErr = t.Out(0) == errorType
+        hasValue = !hasErr
+    case 2:
+        hasValue, hasErr = true, t.Out(1) == errorType
+        if !hasErr {
+            return nil, errors.New("second result must be an error")
+        }
+    default:
+        return nil, errors.New("too many results")
+    }
+    if hasValue && !convertible(t.Out(0)) {
+        return nil, fmt.Errorf("unsupported result type %s", t.Out(0))
+    }
+    return func(p *Process) Action {
+        args := p.Args()
+        if len(args) != len(params)-1 {
+            return Throw(String("wrong number of arguments"))
+        }
+        var in []reflect.Value
+        if withProcess {
+            in = append(in, reflect.ValueOf(p))
+        }
+        for i, param := range params {
+            x := p.Receiver()
+            if i > 0 {
+                x = args[i-1]
+            }
+            v, ok := fromV(x, param)
+            if !ok {
+                if i == 0 {
+                    return Throw(String(fmt.Sprintf("receiver: expected %s", typeName(param))))
+                }
+                return Throw(String(fmt.Sprintf("argument %d: expected %s", i, typeName(param))))
+            }
+            in = append(in, v)
+        }
+        out := f.Call(in)
+        if hasErr {
+            if err, _ := out[len(out)-1].Interface().(error); err != nil {
+                return Throw(String(err.Error()))
+            }
+        }
+        if hasValue {
+            return Return(toV(out[0]))
+        }
+        return Return(V{})
+    }, nil
+}
+
+func convertible(t reflect.Type) bool {
+    if t == vType {
+        return true
+    }
+    switch t.Kind() {
+    case reflect.Int, reflect.Int64, reflect.Float64, reflect.String, reflect.Bool:
+        return true
+    }
+    return false
+}
+
+func typeName(t reflect.Type) string {
+    switch t.Kind() {
+    case reflect.Int, reflect.Int64:
+        return "Integer"
+    case reflect.Float64:
+        return "Float"
+    case reflect.String:
+        return "String"
+    case reflect.Bool:
+        return "Boolean"
+    }
+    return t.String()
+}
+
+func fromV(x V, t reflect.Type) (reflect.Value, bool) {
+    if t == vType {
+        return reflect.ValueOf(x), true
+    }
+    var v interface{}
+    var ok bool
+    switch t.Kind() {
+    case reflect.Int, reflect.Int64:
+        v, ok = x.AsInt()
+    case reflect.Float64:
+        v, ok = x.AsFloat()
+    case reflect.String:
+        v, ok = x.AsString()
+    case reflect.Bool:
+        v, ok = x.val.(bool)
+    }
+    if !ok {
+        return reflect.Value{}, false
+    }
+    return reflect.ValueOf(v).Convert(t), true
+}
+
+func toV(v reflect.Value) V {
+    if v.Type() == vType {
+        return v.Interface().(V)
+    }
+    switch v.Kind() {
+    case reflect.Int, reflect.Int64:
+        return Int(v.Int())
+    case reflect.Float64:
+        return Float(v.Float())
+    case reflect.String:
+        return String(v.String())
+    }
+    return Bool(v.Bool())
+}
@@ -0,0 +1,82 @@
+package script
+
+import (
+    "testing"
+    "errors"
+)
+
+func TestDefinePrimitive(t *testing.T) {
+    host := New()
+    integer := host.builtins.classes.Integer
+    for name, fn := range map[string]interface{}{
+        "add": func(x, y int64) int64 { return x + y },
+        "div": func(x, y int) (int, error) {
+            if y == 0 {
+                return 0, errors.New("division by zero")
+            }
+            return x / y, nil
+        },
+        "repeat": func(p *Process, x int64, s string) string {
+            res := ""
+            for i := int64(0); i < x; i++ {
+                res += s
+            }
+            return res
+        },
+        "ignore": func(x V) {},
+    } {
+        if err := host.DefinePrimitive(integer, name, fn); err != nil {
+            t.Fatal(err)
+        }
+    }
+    cls := integer.val.(*class)
+    for i, test := range ([]struct{name string; args []V; result, thrown V}{
+        {"add", []V{Int(2)}, Int(9), V{}},
+        {"div", []V{Int(2)}, Int(3), V{}},
+        {"div", []V{Int(0)}, V{}, String("division by zero")},
+        {"repeat", []V{String("ab")}, String("ababababababab"), V{}},
+        {"ignore", nil, V{}, V{}},
+        {"add", nil, V{}, String("wrong number of arguments")},
+        {"add", []V{Int(1), Int(2)}, V{}, String("wrong number of arguments")},
+        {"add", []V{String("x")}, V{}, String("argument 1: expected Integer")},
+    }) {
+        result, err := host.Run(sendUnit(Int(7), testName(cls, test.name), test.args...), 0, V{})
+        if test.thrown.val != nil {
+            if serr, ok := err.(*ScriptError); !ok || serr.Value != test.thrown {
+                t.Errorf("[%d]: unexpected error %v", i, err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("[%d]: unexpected error %v", i, err)
+        }
+        if result != test.result {
+            t.Errorf("[%d]: %#v != %#v", i, result, test.result)
+        }
+    }
+}
+
+func TestDefinePrimitiveErrors(t *testing.T) {
+    host := New()
+    integer := host.builtins.classes.Integer
+    for i, fn := range ([]interface{}{
+        1,
+        func() int64 { return 0 },
+        func(x []int) {},
+        func(x int64) (int64, int64) { return 0, 0 },
+        func(x int64) []int { return nil },
+        func(x int64, y ...int64) {},
+    }) {
+        if err := host.DefinePrimitive(integer, "test", fn); err == nil {
+            t.Errorf("[%d]: expected an error", i)
+        }
+    }
+    for i, fn := range ([]interface{}{nil, (func(x int64))(nil)}) {
+        if err := host.DefinePrimitive(integer, "test", fn); !errors.Is(err, ErrNotFunc) {
+            t.Errorf("[%d]: unexpected error %v", i, err)
+        }
+    }
+    if err := host.DefinePrimitive(Int(1), "test", func(x V) {}); err != ErrNotClass {
+        t.Errorf("unexpected error %v", err)
+    }
+}
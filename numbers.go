@@ -0,0 +1,193 @@
+package script
+
+import (
+    "errors"
+    "math"
+)
+
+// Integers and floats have arithmetic and comparison members, and integers
+// also have bitwise members. When the argument has the other numeric type, the
+// integer is converted to a float. Integer arithmetic wraps around on overflow,
+// and dividing by zero throws.
+//
+// When the argument is not a number, the operation is passed to the argument:
+// x.add(y) calls y.radd(x), and the comparison x.lt(y) calls y.gt(x). This lets
+// scripts define their own numeric classes. If the argument has no such member
+// then the operation throws, except for eq and ne, which return false and true.
+type numberOp struct {
+    name, reverse string
+    ints func(x, y int64) Action
+    floats func(x, y float64) Action
+    mismatch Action
+}
+
+var errDivZero = String("division by zero")
+
+func boolean(x bool) Action {
+    return Return(Bool(x))
+}
+
+var arithmeticOps = []numberOp{
+    {"add", "radd",
+        func(x, y int64) Action { return Return(Int(x+y)) },
+        func(x, y float64) Action { return Return(Float(x+y)) },
+        Action{}},
+    {"sub", "rsub",
+        func(x, y int64) Action { return Return(Int(x-y)) },
+        func(x, y float64) Action { return Return(Float(x-y)) },
+        Action{}},
+    {"mul", "rmul",
+        func(x, y int64) Action { return Return(Int(x*y)) },
+        func(x, y float64) Action { return Return(Float(x*y)) },
+        Action{}},
+    {"div", "rdiv",
+        func(x, y int64) Action {
+            if y == 0 {
+                return Throw(errDivZero)
+            }
+            return Return(Int(x/y))
+        },
+        func(x, y float64) Action {
+            if y == 0 {
+                return Throw(errDivZero)
+            }
+            return Return(Float(x/y))
+        },
+        Action{}},
+    {"mod", "rmod",
+        func(x, y int64) Action {
+            if y == 0 {
+                return Throw(errDivZero)
+            }
+            return Return(Int(x%y))
+        },
+        func(x, y float64) Action {
+            if y == 0 {
+                return Throw(errDivZero)
+            }
+            return Return(Float(math.Mod(x, y)))
+        },
+        Action{}},
+    {"lt", "gt",
+        func(x, y int64) Action { return boolean(x < y) },
+        func(x, y float64) Action { return boolean(x < y) },
+        Action{}},
+    {"le", "ge",
+        func(x, y int64) Action { return boolean(x <= y) },
+        func(x, y float64) Action { return boolean(x <= y) },
+        Action{}},
+    {"gt", "lt",
+        func(x, y int64) Action { return boolean(x > y) },
+        func(x, y float64) Action { return boolean(x > y) },
+        Action{}},
+    {"ge", "le",
+        func(x, y int64) Action { return boolean(x >= y) },
+        func(x, y float64) Action { return boolean(x >= y) },
+        Action{}},
+    {"eq", "eq",
+        func(x, y int64) Action { return boolean(x == y) },
+        func(x, y float64) Action { return boolean(x == y) },
+        boolean(false)},
+    {"ne", "ne",
+        func(x, y int64) Action { return boolean(x != y) },
+        func(x, y float64) Action { return boolean(x != y) },
+        boolean(true)},
+}
+
+// Shifts by a negative count throw. Shifting by 64 or more gives 0, or -1 for
+// a negative integer shifted right.
+var bitwiseOps = []numberOp{
+    {"and", "", func(x, y int64) Action { return Return(Int(x&y)) }, nil, Action{}},
+    {"or", "", func(x, y int64) Action { return Return(Int(x|y)) }, nil, Action{}},
+    {"xor", "", func(x, y int64) Action { return Return(Int(x^y)) }, nil, Action{}},
+    {"shl", "", func(x, y int64) Action {
+        if y < 0 {
+            return Throw(String("negative shift count"))
+        }
+        return Return(Int(x << uint64(y)))
+    }, nil, Action{}},
+    {"shr", "", func(x, y int64) Action {
+        if y < 0 {
+            return Throw(String("negative shift count"))
+        }
+        return Return(Int(x >> uint64(y)))
+    }, nil, Action{}},
+}
+
+func (e *Interpreter) initNumbers() {
+    cs := e.builtins.classes
+    var ints, floats []builtinMember
+    for _, op := range arithmeticOps {
+        prim := e.numberPrimitive(op)
+        ints = append(ints, builtinMember{op.name, prim})
+        floats = append(floats, builtinMember{op.name, prim})
+    }
+    for _, op := range bitwiseOps {
+        ints = append(ints, builtinMember{op.name, e.numberPrimitive(op)})
+    }
+    ints = append(ints,
+        builtinMember{"neg", func(x int64) int64 { return -x }},
+        builtinMember{"not", func(x int64) int64 { return ^x }},
+        builtinMember{"toFloat", func(x int64) float64 { return float64(x) }},
+    )
+    floats = append(floats,
+        builtinMember{"neg", func(x float64) float64 { return -x }},
+        builtinMember{"toInteger", floatToInteger},
+    )
+    e.defineBuiltins(cs.Integer, ints)
+    e.defineBuiltins(cs.Float, floats)
+}
+
+// The common cases are handled without any further lookups, so that sends like
+// i.add(1) are cheap.
+func (e *Interpreter) numberPrimitive(op numberOp) Primitive {
+    var reverse *Name
+    if op.reverse != "" {
+        reverse = e.Intern(op.reverse)
+    }
+    return func(p *Process) Action {
+        if p.argc != 1 {
+            return Throw(String("wrong number of arguments"))
+        }
+        y := p.stack[len(p.stack)-1]
+        switch xv := p.result.val.(type) {
+        case int64:
+            switch yv := y.val.(type) {
+            case int64:
+                return op.ints(xv, yv)
+            case float64:
+                if op.floats != nil {
+                    return op.floats(float64(xv), yv)
+                }
+            }
+        case float64:
+            switch yv := y.val.(type) {
+            case int64:
+                return op.floats(xv, float64(yv))
+            case float64:
+                return op.floats(xv, yv)
+            }
+        }
+        if reverse != nil {
+            if c, ok := p.host.ClassOf(y).val.(*class); ok {
+                if m, err := c.lookup(reverse); err == nil {
+                    return Call(m, y, p.result)
+                }
+            }
+        }
+        if op.mismatch.kind != continueAction {
+            return op.mismatch
+        }
+        if op.floats == nil {
+            return Throw(String("argument 1: expected Integer"))
+        }
+        return Throw(String("argument 1: expected a number"))
+    }
+}
+
+func floatToInteger(x float64) (int64, error) {
+    if math.IsNaN(x) || x < math.MinInt64 || x >= math.MaxInt64 {
+        return 0, errors.New("float out of range")
+    }
+    return int64(x), nil
+}
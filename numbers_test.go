@@ -0,0 +1,143 @@
+package script
+
+import (
+    "testing"
+    "math"
+)
+
+func TestArithmetic(t *testing.T) {
+    host := New()
+    number, err := host.DefineClass("Number", V{}, nil, map[string]V{
+        "radd": V{Primitive(func(p *Process) Action {
+            return Return(String("radd"))
+        })},
+        "gt": V{Primitive(func(p *Process) Action {
+            return Return(String("gt"))
+        })},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    num, _ := host.New(number)
+    for i, test := range ([]struct{recv V; name string; args []V; result V; thrown string}{
+        {Int(2), "add", []V{Int(3)}, Int(5), ""},
+        {Int(2), "add", []V{Float(0.5)}, Float(2.5), ""},
+        {Float(0.5), "add", []V{Int(2)}, Float(2.5), ""},
+        {Int(math.MaxInt64), "add", []V{Int(1)}, Int(math.MinInt64), ""},
+        {Int(2), "sub", []V{Int(3)}, Int(-1), ""},
+        {Int(2), "mul", []V{Float(1.5)}, Float(3), ""},
+        {Int(7), "div", []V{Int(2)}, Int(3), ""},
+        {Int(-7), "div", []V{Int(2)}, Int(-3), ""},
+        {Int(7), "div", []V{Float(2)}, Float(3.5), ""},
+        {Int(7), "div", []V{Int(0)}, V{}, "division by zero"},
+        {Float(7), "div", []V{Float(0)}, V{}, "division by zero"},
+        {Int(math.MinInt64), "div", []V{Int(-1)}, Int(math.MinInt64), ""},
+        {Int(7), "mod", []V{Int(3)}, Int(1), ""},
+        {Float(7.5), "mod", []V{Int(2)}, Float(1.5), ""},
+        {Int(7), "mod", []V{Int(0)}, V{}, "division by zero"},
+        {Int(1), "lt", []V{Int(2)}, V{true}, ""},
+        {Int(2), "le", []V{Float(1.5)}, V{false}, ""},
+        {Float(2), "gt", []V{Int(1)}, V{true}, ""},
+        {Int(2), "ge", []V{Int(2)}, V{true}, ""},
+        {Int(2), "eq", []V{Float(2)}, V{true}, ""},
+        {Int(2), "eq", []V{String("2")}, V{false}, ""},
+        {Int(2), "ne", []V{String("2")}, V{true}, ""},
+        {Int(6), "and", []V{Int(3)}, Int(2), ""},
+        {Int(6), "or", []V{Int(3)}, Int(7), ""},
+        {Int(6), "xor", []V{Int(3)}, Int(5), ""},
+        {Int(1), "shl", []V{Int(4)}, Int(16), ""},
+        {Int(-16), "shr", []V{Int(2)}, Int(-4), ""},
+        {Int(1), "shl", []V{Int(64)}, Int(0), ""},
+        {Int(1), "shl", []V{Int(-1)}, V{}, "negative shift count"},
+        {Int(1), "and", []V{Float(1)}, V{}, "argument 1: expected Integer"},
+        {Int(5), "neg", nil, Int(-5), ""},
+        {Int(5), "not", nil, Int(-6), ""},
+        {Int(5), "toFloat", nil, Float(5), ""},
+        {Float(-2.7), "toInteger", nil, Int(-2), ""},
+        {Float(math.Inf(1)), "toInteger", nil, V{}, "float out of range"},
+        {Int(1), "add", []V{String("x")}, V{}, "argument 1: expected a number"},
+        {Int(1), "add", []V{num}, String("radd"), ""},
+        {Float(1), "lt", []V{num}, String("gt"), ""},
+        {Int(1), "add", nil, V{}, "wrong number of arguments"},
+    }) {
+        result, err := host.Run(sendUnit(test.recv, host.Intern(test.name), test.args...), 0, V{})
+        if test.thrown != "" {
+            if serr, ok := err.(*ScriptError); !ok || serr.Value != String(test.thrown) {
+                t.Errorf("[%d]: unexpected error %v", i, err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("[%d]: unexpected error %v", i, err)
+        }
+        if result != test.result {
+            t.Errorf("[%d]: %#v != %#v", i, result, test.result)
+        }
+    }
+}
+
+const countSource = `
+    .class Counter
+    .method count 2
+        FRAME compared
+        BOUND 1
+        PUSH
+        BOUND 0
+        LOOKUP lt
+        CALL 1
+    compared:
+        BRANCH done
+        FRAME added
+        GLOBAL 1
+        PUSH
+        BOUND 0
+        LOOKUP add
+        CALL 1
+    added:
+        PUSH
+        BOUND 1
+        PUSH
+        THIS
+        LOOKUP count
+        TCALL 2
+    done:
+        BOUND 0
+        RETURN
+    .end
+`
+
+func counter(t testing.TB, host *Interpreter) (*Unit, int, V) {
+    a, err := Assemble(countSource)
+    if err != nil {
+        t.Fatal(err)
+    }
+    u, err := host.LoadAssembly(a)
+    if err != nil {
+        t.Fatal(err)
+    }
+    cls, _ := a.Entry("Counter")
+    entry, _ := a.Entry("Counter.count")
+    obj, _ := host.New(u.Values[cls])
+    return u, entry, obj
+}
+
+func TestCountLoop(t *testing.T) {
+    host := New()
+    u, entry, obj := counter(t, host)
+    result, err := host.Run(u, entry, obj, Int(0), Int(1000))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if result != Int(1000) {
+        t.Errorf("%#v != 1000", result)
+    }
+}
+
+func BenchmarkCountLoop(b *testing.B) {
+    host := New()
+    u, entry, obj := counter(b, host)
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        host.Run(u, entry, obj, Int(0), Int(1000))
+    }
+}
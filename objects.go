@@ -1,9 +1,11 @@
 package script
 
 import (
+    "sync"
     "sync/atomic"
     "unsafe"
     "sort"
+    "fmt"
 )
 
 // A value in the scripting language. Everything accessible from user code is an
@@ -20,7 +22,20 @@ type UserObject struct {
 
 // All values have a type. This is usually an instance of a class.
 type class struct {
+    name *Name
     ancestor *class
+    __members *classMembers
+    defineLock sync.Mutex
+    // Builtin classes whose instances are not objects make them with this
+    // rather than Class.new's usual way. It is not inherited.
+    newFn Primitive
+}
+
+// A class's shape and the names and values at each offset within it. These
+// change together when a member is added, so they are replaced as a whole and
+// never modified once the class is in use. Processes running on other
+// goroutines see either the old members or the new ones.
+type classMembers struct {
     shape *shape
     names []*Name
     values []V
@@ -33,6 +48,7 @@ type Name struct {
     id entityId
     str string
     parent *Name
+    fallback *Name
     __items *[]nameItem
 }
 
@@ -53,15 +69,53 @@ type shape struct {
     __children *[]*shape
 }
 
+// Members added to a class after its descendants were created are found by
+// searching the ancestors. If a qualified name is not found anywhere then its
+// fallback is tried.
 func (c *class) lookup(n *Name) (res V, err error) {
-    idx := c.shape.lookup(n)
-    if idx == -1 {
-        return
+    for m := n; m != nil; m = m.fallback {
+        for a := c; a != nil; a = a.ancestor {
+            ms := a.getMembers()
+            idx := ms.shape.lookup(m)
+            if idx != -1 {
+                res = ms.values[idx]
+                return
+            }
+        }
     }
-    res = c.values[idx]
+    err = fmt.Errorf("%s: no such member", n.String())
     return
 }
 
+// Add a member to the class, or replace it if it is already there. Classes may
+// be extended while processes are using them.
+func (c *class) define(n *Name, x V) {
+    c.defineLock.Lock()
+    defer c.defineLock.Unlock()
+    old := c.getMembers()
+    ms := &classMembers{shape: old.shape.extend([]*Name{n})}
+    ms.names = make([]*Name, ms.shape.size)
+    ms.values = make([]V, ms.shape.size)
+    copy(ms.names, old.names)
+    copy(ms.values, old.values)
+    offset := ms.shape.lookup(n)
+    ms.names[offset] = n
+    ms.values[offset] = x
+    c.setMembers(ms)
+}
+
+func (c *class) getMembersLoc() *unsafe.Pointer {
+    return (*unsafe.Pointer)(unsafe.Pointer(&c.__members))
+}
+
+func (c *class) getMembers() *classMembers {
+    return (*classMembers)(atomic.LoadPointer(c.getMembersLoc()))
+}
+
+func (c *class) setMembers(ms *classMembers) {
+    atomic.StorePointer(c.getMembersLoc(), unsafe.Pointer(ms))
+}
+
 type atomicCounter uint32
 
 func (c *atomicCounter) next() entityId {
@@ -136,7 +190,7 @@ func (s *shape) tryAppendChild(x *shape) bool {
     copy(children, oldChildren)
     children[len(oldChildren)] = x
     newP := unsafe.Pointer(&children)
-    return !atomic.CompareAndSwapPointer(p, oldP, newP)
+    return atomic.CompareAndSwapPointer(p, oldP, newP)
 }
 
 func (s *shape) lookup(n *Name) int {
@@ -203,6 +257,22 @@ func (s *shape) contains(ns []*Name) bool {
 
 // Basic objects
 
+func True() V {
+    return V{true}
+}
+
+func False() V {
+    return V{false}
+}
+
+func Bool(x bool) V {
+    return V{x}
+}
+
+func Nil() V {
+    return V{}
+}
+
 func Int(x int64) V {
     return V{x}
 }
@@ -215,6 +285,12 @@ func String(x string) V {
     return V{x}
 }
 
+// Arrays hold a copy of their initial elements.
+func Array(xs ...V) V {
+    a := append([]V{}, xs...)
+    return V{&a}
+}
+
 func (v V) AsInt() (val int64, ok bool) {
     val, ok = v.val.(int64)
     return
@@ -235,12 +311,24 @@ func (v V) AsObject() (val *UserObject, ok bool) {
     return
 }
 
+func (v V) AsArray() (val *[]V, ok bool) {
+    val, ok = v.val.(*[]V)
+    return
+}
+
+// Nil and false are false, and everything else is true.
 func (v V) AsBool() bool {
-    val, ok := v.val.(bool)
-    if !ok {
-        return true
+    switch x := v.val.(type) {
+    case nil:
+        return false
+    case bool:
+        return x
     }
-    return val
+    return true
+}
+
+func (v V) IsNil() bool {
+    return v.val == nil
 }
 
 func (e *Interpreter) ClassOf(x V) V {
@@ -260,8 +348,20 @@ func (e *Interpreter) ClassOf(x V) V {
         return cs.Array
     case Primitive:
         return cs.Primitive
+    case *method:
+        return cs.Method
+    case *closure:
+        return cs.Closure
+    case *Thread:
+        return cs.Thread
+    case *Channel:
+        return cs.Channel
+    case bool:
+        return cs.Boolean
+    case nil:
+        return cs.Nil
     }
-    panic("unkown object type")
+    return cs.Object
 }
 
 
@@ -0,0 +1,191 @@
+package script
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "strings"
+)
+
+// Packages are objects whose members are the exports of the image that
+// declares them. They form a tree under packageRoot, where the package "a.b" is
+// the member b of the package a, so a cannot also export a member called b.
+
+// Finds the images of packages that are imported but not yet loaded.
+type PackageSource interface {
+    // Open the image of the package with the given path.
+    OpenPackage(path string) (io.ReadCloser, error)
+}
+
+var (
+    ErrNoPackage = errors.New("package not found")
+    ErrImportCycle = errors.New("import cycle")
+    ErrPackageLoaded = errors.New("package already loaded")
+    ErrWrongPackage = errors.New("image declares a different package")
+    ErrMemberConflict = errors.New("member has the same name as a subpackage")
+)
+
+// Reported when a package cannot be imported or linked.
+type PackageError struct {
+    Path string
+    Err error
+}
+
+func (e *PackageError) Error() string {
+    return fmt.Sprintf("package %s: %s", e.Path, e.Err)
+}
+
+func (e *PackageError) Unwrap() error {
+    return e.Err
+}
+
+// Use src to find the packages that images import.
+func (host *Interpreter) SetPackageSource(src PackageSource) {
+    host.packagesLock.Lock()
+    defer host.packagesLock.Unlock()
+    host.source = src
+}
+
+// Find the package with the given path, loading it first if necessary.
+func (host *Interpreter) Import(path string) (V, error) {
+    host.packagesLock.Lock()
+    defer host.packagesLock.Unlock()
+    return host.importPackage(host.Intern(path))
+}
+
+func (host *Interpreter) importPackage(path *Name) (V, error) {
+    if host.loaded[path] {
+        return host.packageObject(path)
+    }
+    if err := host.checkCycle(path); err != nil {
+        return V{}, err
+    }
+    if host.source == nil {
+        return V{}, &PackageError{path.String(), ErrNoPackage}
+    }
+    r, err := host.source.OpenPackage(path.String())
+    if err != nil {
+        return V{}, &PackageError{path.String(), err}
+    }
+    defer r.Close()
+    l, err := host.decode(r)
+    if err == nil && l.unit.Package != path {
+        err = &PackageError{path.String(), ErrWrongPackage}
+    }
+    if err == nil && host.verifyImports {
+        err = l.unit.Verify()
+    }
+    if err == nil {
+        _, err = l.link()
+    }
+    if err != nil {
+        if _, ok := err.(*PackageError); !ok {
+            err = &PackageError{path.String(), err}
+        }
+        return V{}, err
+    }
+    return host.packageObject(path)
+}
+
+// Note that an image for path is being loaded.
+func (host *Interpreter) enterPackage(path *Name) error {
+    if host.loaded[path] {
+        return &PackageError{path.String(), ErrPackageLoaded}
+    }
+    if err := host.checkCycle(path); err != nil {
+        return err
+    }
+    host.importing = append(host.importing, path)
+    return nil
+}
+
+func (host *Interpreter) leavePackage(depth int) {
+    host.importing = host.importing[:depth]
+}
+
+func (host *Interpreter) checkCycle(path *Name) error {
+    for i, p := range host.importing {
+        if p != path {
+            continue
+        }
+        var chain []string
+        for _, q := range host.importing[i:] {
+            chain = append(chain, q.String())
+        }
+        chain = append(chain, path.String())
+        return &PackageError{path.String(), fmt.Errorf("%w: %s", ErrImportCycle, strings.Join(chain, " -> "))}
+    }
+    return nil
+}
+
+// Add the exports of a loaded image to its package. Nothing is added if any
+// export would hide a subpackage.
+func (host *Interpreter) linkPackage(path *Name, exports []export) error {
+    if path == nil {
+        return nil
+    }
+    for _, e := range exports {
+        if e.name.parent != nil {
+            continue
+        }
+        if _, ok := host.packages[host.Intern(path.String() + "." + e.name.str)]; ok {
+            return &PackageError{path.String(), fmt.Errorf("%w: %s", ErrMemberConflict, e.name.str)}
+        }
+    }
+    pkg, err := host.packageObject(path)
+    if err != nil {
+        return err
+    }
+    c := packageClass(pkg)
+    for _, e := range exports {
+        c.define(e.name, e.value)
+    }
+    host.loaded[path] = true
+    return nil
+}
+
+// Find the object for a package, creating it and its parents if they do not
+// exist yet. A package cannot be created where its parent already has a member
+// with the same name.
+func (host *Interpreter) packageObject(path *Name) (V, error) {
+    if path == nil {
+        return host.packageRoot, nil
+    }
+    if pkg, ok := host.packages[path]; ok {
+        return pkg, nil
+    }
+    parent, err := host.packageObject(path.parent)
+    if err != nil {
+        return V{}, err
+    }
+    c := packageClass(parent)
+    member := host.Intern(path.str)
+    if c.getMembers().shape.lookup(member) != -1 {
+        return V{}, &PackageError{path.String(), ErrMemberConflict}
+    }
+    pkg := host.newPackage(path)
+    c.define(member, pkg)
+    host.packages[path] = pkg
+    return pkg, nil
+}
+
+func packageClass(pkg V) *class {
+    return pkg.val.(*UserObject).class.val.(*class)
+}
+
+func (host *Interpreter) newPackage(path *Name) V {
+    object := host.builtins.classes.Object.val.(*class)
+    return V{&UserObject{V{newClass(path, object, nil, nil)}, nil}}
+}
+
+// Packages provided by the interpreter are already loaded, so importing them
+// never looks for an image.
+func (host *Interpreter) builtinPackage(path string, members []builtinMember) {
+    n := host.Intern(path)
+    pkg, err := host.packageObject(n)
+    if err != nil {
+        panic(err.Error())
+    }
+    host.defineBuiltins(pkg.val.(*UserObject).class, members)
+    host.loaded[n] = true
+}
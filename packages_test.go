@@ -0,0 +1,166 @@
+package script
+
+import (
+    "testing"
+    "bytes"
+    "errors"
+    "io"
+    "strings"
+)
+
+type testSource struct {
+    t *testing.T
+    listings map[string]string
+    opened map[string]int
+}
+
+func (s *testSource) OpenPackage(path string) (io.ReadCloser, error) {
+    src, ok := s.listings[path]
+    if !ok {
+        return nil, ErrNoPackage
+    }
+    s.opened[path]++
+    a, err := Assemble(src)
+    if err != nil {
+        s.t.Fatal(err)
+    }
+    buf := new(bytes.Buffer)
+    if _, err := a.WriteTo(buf); err != nil {
+        s.t.Fatal(err)
+    }
+    return io.NopCloser(buf), nil
+}
+
+func TestPackages(t *testing.T) {
+    host := New()
+    src := &testSource{t, map[string]string{
+        "lib.math": `
+            .package lib.math
+            .const answer 42
+            .method identity 1
+                BOUND 0
+                RETURN
+            .export answer
+            .export identity
+        `,
+        "cycle.a": `
+            .package cycle.a
+            .import b cycle.b
+        `,
+        "cycle.b": `
+            .package cycle.b
+            .import a cycle.a
+        `,
+        "broken": `
+            .package broken
+            .import x nothing.there
+        `,
+        "wrong": `
+            .package right
+        `,
+    }, map[string]int{}}
+    host.SetPackageSource(src)
+    u, a := assembleUnit(t, host, `
+        .package app
+        .import math lib.math
+        .method answer 0
+            GLOBAL math
+            LOOKUP answer
+            GET
+            RETURN
+        .method identity 0
+            GLOBAL 7
+            PUSH
+            GLOBAL math
+            LOOKUP identity
+            TCALL 1
+    `)
+    if u.Package != host.Intern("app") {
+        t.Errorf("unexpected package %v", u.Package)
+    }
+    for i, test := range ([]struct{entry string; result V}{
+        {"answer", Int(42)},
+        {"identity", Int(7)},
+    }) {
+        entry, _ := a.Entry(test.entry)
+        result, err := host.Run(u, entry, V{})
+        if err != nil {
+            t.Errorf("[%d]: unexpected error %v", i, err)
+        }
+        if result != test.result {
+            t.Errorf("[%d]: %#v != %#v", i, result, test.result)
+        }
+    }
+    math, err := host.Import("lib.math")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if src.opened["lib.math"] != 1 {
+        t.Errorf("lib.math opened %d times", src.opened["lib.math"])
+    }
+    lib, _ := host.packageRoot.val.(*UserObject).class.val.(*class).lookup(host.Intern("lib"))
+    if m, _ := lib.val.(*UserObject).class.val.(*class).lookup(host.Intern("math")); m != math {
+        t.Error("lib.math is not under the package root")
+    }
+    if _, err := host.LoadAssembly(a); !errors.Is(err, ErrPackageLoaded) {
+        t.Errorf("unexpected error %v", err)
+    }
+    for i, test := range ([]struct{path string; err error; msg string}{
+        {"cycle.a", ErrImportCycle, "package cycle.a: import cycle: cycle.a -> cycle.b -> cycle.a"},
+        {"missing", ErrNoPackage, "package missing: package not found"},
+        {"broken", ErrNoPackage, "package nothing.there: package not found"},
+        {"wrong", ErrWrongPackage, "package wrong: image declares a different package"},
+        // Nothing is registered by the failed import.
+        {"wrong", ErrWrongPackage, "package wrong: image declares a different package"},
+        {"right", ErrNoPackage, "package right: package not found"},
+    }) {
+        _, err := host.Import(test.path)
+        if !errors.Is(err, test.err) {
+            t.Errorf("[%d]: unexpected error %v", i, err)
+            continue
+        }
+        if !strings.Contains(err.Error(), test.msg) {
+            t.Errorf("[%d]: unexpected message %q", i, err)
+        }
+    }
+}
+
+func TestPackageMemberConflicts(t *testing.T) {
+    host := New()
+    host.SetPackageSource(&testSource{t, map[string]string{
+        "x": `
+            .package x
+            .const y 1
+            .export y
+        `,
+        "x.y": `
+            .package x.y
+        `,
+        "p.q": `
+            .package p.q
+        `,
+        "p": `
+            .package p
+            .const q 1
+            .export q
+        `,
+    }, map[string]int{}})
+    for i, test := range ([]struct{path string; err error; msg string}{
+        {"x", nil, ""},
+        {"x.y", ErrMemberConflict, "package x.y: member has the same name as a subpackage"},
+        {"p.q", nil, ""},
+        {"p", ErrMemberConflict, "package p: member has the same name as a subpackage: q"},
+        {"p.q", nil, ""},
+    }) {
+        _, err := host.Import(test.path)
+        if test.err == nil {
+            if err != nil {
+                t.Errorf("[%d]: unexpected error %v", i, err)
+            }
+            continue
+        }
+        if !errors.Is(err, test.err) || err.Error() != test.msg {
+            t.Errorf("[%d]: unexpected error %v", i, err)
+        }
+    }
+}
@@ -2,25 +2,129 @@ package script
 
 import ()
 
+// Primitives are methods implemented in Go. A primitive is called with its
+// receiver and arguments available from the process, and returns an Action
+// saying what the process should do next.
 type Primitive func(*Process) Action
 
+// Primitives that call back into the process receive the result of the call
+// through a continuation.
+type Continuation func(p *Process, result V) Action
+
 type Action struct {
     kind int
     data V
 }
 
+const (
+    // The primitive has arranged for the process to continue by itself, e.g.
+    // by entering a method.
+    continueAction = iota
+    returnAction
+    callAction
+    throwAction
+    suspendAction
+)
+
+type callData struct {
+    slot, this V
+    args []V
+    k Continuation
+}
+
 type builtins struct {
     classes builtinClasses
     names builtinNames
 }
 
+// Return x to the primitive's caller.
+func Return(x V) Action {
+    return Action{returnAction, x}
+}
 
-func (a Action) perform(p *Process) {
+// Call slot with the given receiver and arguments. Whatever it returns is
+// returned to the primitive's caller.
+func Call(slot, this V, args ...V) Action {
+    return Action{callAction, V{&callData{slot, this, args, nil}}}
 }
 
-type builtinNames struct {
-    lookup, getSlot, setSlot, callSlot V
+// Call slot with the given receiver and arguments, then pass the result to k.
+// The action returned by k is then performed in turn.
+func CallThen(k Continuation, slot, this V, args ...V) Action {
+    return Action{callAction, V{&callData{slot, this, args, k}}}
+}
+
+// Throw x from the point where the primitive was called.
+func Throw(x V) Action {
+    return Action{throwAction, x}
 }
 
+// Stop running the process. When it is resumed the primitive returns the value
+// passed to Process.Resume.
+func Suspend() Action {
+    return Action{suspendAction, V{}}
+}
 
+// The receiver of the primitive that is currently running.
+func (p *Process) Receiver() V {
+    return p.result
+}
+
+// The arguments passed to the primitive that is currently running.
+func (p *Process) Args() []V {
+    return p.stack[len(p.stack)-p.argc:]
+}
 
+func (p *Process) Interpreter() *Interpreter {
+    return p.host
+}
+
+func (a Action) perform(p *Process) {
+    switch a.kind {
+    case returnAction:
+        p.result = a.data
+        p.leave()
+    case callAction:
+        c := a.data.val.(*callData)
+        p.stack = p.stack[:len(p.stack)-p.argc]
+        if c.k != nil {
+            p.enterContinuation(c.k)
+        }
+        for _, x := range c.args {
+            p.push(x)
+        }
+        p.result = c.this
+        p.slot = c.slot
+        p.call(len(c.args), false)
+    case throwAction:
+        p.throw(a.data)
+    case suspendAction:
+        p.status = suspended
+    }
+}
+
+var resumeCode = Code{RESUME}
+
+// Arrange for k to be called when the current call returns. The primitive's
+// arguments must already have been removed from the stack.
+func (p *Process) enterContinuation(k Continuation) {
+    f := p.frame
+    p.slot = V{k}
+    p.handler = V{}
+    p.argc = 0
+    p.pos = 0
+    p.code = resumeCode
+    p.enter()
+    p.frame = f
+}
+
+func (p *Process) resume() {
+    k := p.slot.val.(Continuation)
+    p.slot = V{}
+    k(p, p.result).perform(p)
+}
+
+type builtinNames struct {
+    lookup, getSlot, setSlot, callSlot V
+    new, init, extend V
+}
@@ -0,0 +1,113 @@
+package script
+
+import (
+    "testing"
+)
+
+// Build a unit whose entry point, at index 0, sends a message to recv and
+// returns the result.
+func sendUnit(recv V, name *Name, args ...V) *Unit {
+    u := &Unit{}
+    u.Values = []V{V{}, recv, V{name}}
+    code := Code{FRAME, 0,0}
+    for _, x := range args {
+        code = append(code, GLOBAL, byte(len(u.Values)),0,0,0, PUSH)
+        u.Values = append(u.Values, x)
+    }
+    code = append(code, GLOBAL, 1,0,0,0, LOOKUP, 2,0,0,0, CALL, byte(len(args)))
+    code[1] = byte(len(code))
+    code = append(code, RETURN)
+    u.Values[0] = V{newMethod(nil, 0, code, u)}
+    return u
+}
+
+func testClass(host *Interpreter, members map[string]V) *class {
+    var names []*Name
+    var values []V
+    for n, v := range members {
+        names = append(names, new(Name).init(n))
+        values = append(values, v)
+    }
+    object := host.builtins.classes.Object.val.(*class)
+    return newClass(new(Name).init("Test"), object, names, values)
+}
+
+func testName(c *class, str string) *Name {
+    for _, n := range c.getMembers().names {
+        if n.str == str {
+            return n
+        }
+    }
+    return nil
+}
+
+func TestActions(t *testing.T) {
+    host := New()
+    u := &Unit{}
+    first := V{newMethod(nil, 2, Code{BOUND, 0, RETURN}, u)}
+    cls := testClass(host, map[string]V{
+        "return": V{Primitive(func(p *Process) Action {
+            return Return(p.Args()[0])
+        })},
+        "call": V{Primitive(func(p *Process) Action {
+            return Call(first, p.Receiver(), p.Args()[0], Int(0))
+        })},
+        "callThen": V{Primitive(func(p *Process) Action {
+            return CallThen(func(p *Process, x V) Action {
+                n, _ := x.AsInt()
+                return Return(Int(n+1))
+            }, first, p.Receiver(), p.Args()[0], Int(0))
+        })},
+        "throw": V{Primitive(func(p *Process) Action {
+            return Throw(p.Args()[0])
+        })},
+    })
+    obj := V{&UserObject{V{cls}, nil}}
+    for i, test := range ([]struct{name string; result V; err bool}{
+        {"return", Int(1), false},
+        {"call", Int(1), false},
+        {"callThen", Int(2), false},
+        {"throw", V{}, true},
+    }) {
+        result, err := host.Run(sendUnit(obj, testName(cls, test.name), Int(1)), 0, V{})
+        if test.err {
+            if serr, ok := err.(*ScriptError); !ok || serr.Value != Int(1) {
+                t.Errorf("[%d]: unexpected error %v", i, err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("[%d]: unexpected error %v", i, err)
+        }
+        if result != test.result {
+            t.Errorf("[%d]: %#v != %#v", i, result, test.result)
+        }
+    }
+}
+
+func TestSuspend(t *testing.T) {
+    host := New()
+    cls := testClass(host, map[string]V{
+        "wait": V{Primitive(func(p *Process) Action {
+            return Suspend()
+        })},
+    })
+    u := sendUnit(V{&UserObject{V{cls}, nil}}, testName(cls, "wait"))
+    p, err := host.Spawn(u, 0, V{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := p.Run(); err != ErrSuspended {
+        t.Fatalf("unexpected error %v", err)
+    }
+    result, err := p.Resume(Int(5))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if result != Int(5) {
+        t.Errorf("%#v != 5", result)
+    }
+    if _, err := p.Resume(Int(5)); err != ErrNotSuspended {
+        t.Errorf("unexpected error %v", err)
+    }
+}
@@ -0,0 +1,387 @@
+package script
+
+import (
+    "container/heap"
+    "errors"
+    "sync"
+    "time"
+)
+
+var (
+    ErrDeadlock = errors.New("all threads are blocked")
+    ErrRunning = errors.New("thread has not finished")
+)
+
+// The number of instructions a thread runs before another gets a turn, unless
+// the Scheduler says otherwise.
+const DefaultQuantum = 1000
+
+// A Scheduler runs any number of threads on the goroutine that calls Run. Each
+// thread is a Process, and takes turns with the others, running for at most
+// Quantum instructions at a time. Scripts can give up their turn early with
+// the primitives in the thread package:
+//
+//     thread.spawn(f, args...)  call f with args in a new thread
+//     thread.current()          the thread that is running
+//     thread.yield()            let the other threads run
+//     thread.sleep(ms)          wait for at least ms milliseconds
+//     t.join()                  wait for t to finish and return its result
+//
+// Threads can also wait on channels, which other goroutines may use to pass
+// values in and out while Run is going. Otherwise only the goroutine calling
+// Run should use the Scheduler.
+type Scheduler struct {
+    host *Interpreter
+    Quantum int
+    sleeping sleepQueue
+    seq uint64
+    // The lock covers the fields below, which change when threads are woken
+    // from other goroutines. Waking a thread also signals notify.
+    lock sync.Mutex
+    notify chan struct{}
+    ready []*Thread
+    live int
+    // The number of threads waiting on channels that the host can use.
+    hostWaits int
+}
+
+// A Thread is a Process being run by a Scheduler. While a thread is waiting it
+// is parked, and whatever it is waiting for puts it back in the ready queue.
+type Thread struct {
+    sched *Scheduler
+    p *Process
+    done, parked bool
+    // What the primitive that parked the thread returns, or throws if thrown
+    // is set, when the thread runs again.
+    resumeValue V
+    thrown bool
+    wake time.Time
+    seq uint64
+    joiners []*Thread
+    // Set while the thread waits on a channel the host can use.
+    external bool
+}
+
+func (host *Interpreter) NewScheduler() *Scheduler {
+    return &Scheduler{host: host, Quantum: DefaultQuantum, notify: make(chan struct{}, 1)}
+}
+
+// Prepare a thread that will call the method at index entry in the unit's
+// values, as with Interpreter.Spawn. The thread starts when the scheduler runs.
+func (s *Scheduler) Spawn(u *Unit, entry int, this V, args ...V) (*Thread, error) {
+    p, err := s.host.Spawn(u, entry, this, args...)
+    if err != nil {
+        return nil, err
+    }
+    return s.start(p), nil
+}
+
+func (s *Scheduler) start(p *Process) *Thread {
+    t := &Thread{sched: s, p: p}
+    p.thread = t
+    s.lock.Lock()
+    s.live++
+    s.ready = append(s.ready, t)
+    s.lock.Unlock()
+    return t
+}
+
+// Run threads until they have all finished. If the only threads left are
+// waiting for each other then Run returns ErrDeadlock. Threads that are waiting
+// on channels the host can use might still be woken, so Run waits for them.
+// Threads that throw values they do not catch finish, and the error is given
+// by Thread.Result.
+func (s *Scheduler) Run() error {
+    for {
+        s.wakeSleepers(time.Now())
+        s.lock.Lock()
+        if s.live == 0 {
+            s.lock.Unlock()
+            return nil
+        }
+        var t *Thread
+        if len(s.ready) != 0 {
+            t = s.ready[0]
+            s.ready[0] = nil
+            s.ready = s.ready[1:]
+        }
+        deadlock := t == nil && len(s.sleeping) == 0 && s.hostWaits == 0
+        s.lock.Unlock()
+        if deadlock {
+            return ErrDeadlock
+        }
+        if t == nil {
+            s.idle()
+            continue
+        }
+        s.step(t)
+    }
+}
+
+// Wait for a thread to be woken, or for the next sleeper's time to come.
+func (s *Scheduler) idle() {
+    if len(s.sleeping) == 0 {
+        <-s.notify
+        return
+    }
+    timer := time.NewTimer(time.Until(s.sleeping[0].wake))
+    defer timer.Stop()
+    select {
+    case <-s.notify:
+    case <-timer.C:
+    }
+}
+
+// Give a thread its turn.
+func (s *Scheduler) step(t *Thread) {
+    p := t.p
+    quantum := s.Quantum
+    if quantum <= 0 {
+        quantum = DefaultQuantum
+    }
+    p.budget = quantum
+    switch p.status {
+    case suspended:
+        p.status = running
+        t.parked = false
+        x := t.resumeValue
+        t.resumeValue = V{}
+        if t.thrown {
+            t.thrown = false
+            p.protect(func() { p.throw(x) })
+        } else {
+            p.result = x
+            p.leave()
+        }
+    case preempted:
+        p.status = running
+    }
+    for p.status == running {
+        p.runProtected()
+    }
+    p.budget = 0
+    p.flushCacheStats()
+    switch p.status {
+    case preempted:
+        s.lock.Lock()
+        s.ready = append(s.ready, t)
+        s.lock.Unlock()
+    case suspended:
+        // Only the scheduler knows how to wake a thread.
+        if !t.parked {
+            p.status = failed
+            p.err = ErrSuspended
+            s.finish(t)
+        }
+    case finished, failed:
+        s.finish(t)
+    }
+}
+
+func (s *Scheduler) finish(t *Thread) {
+    t.done = true
+    s.lock.Lock()
+    s.live--
+    s.lock.Unlock()
+    x, thrown := t.outcome()
+    for _, j := range t.joiners {
+        s.wake(j, x, thrown)
+    }
+    t.joiners = nil
+}
+
+// Make a parked thread ready. When it runs, the primitive that parked it
+// returns x, or throws x if thrown is set. Any goroutine may wake a thread.
+func (s *Scheduler) wake(t *Thread, x V, thrown bool) {
+    s.lock.Lock()
+    t.resumeValue = x
+    t.thrown = thrown
+    if t.external {
+        t.external = false
+        s.hostWaits--
+    }
+    s.ready = append(s.ready, t)
+    s.lock.Unlock()
+    select {
+    case s.notify <- struct{}{}:
+    default:
+    }
+}
+
+// Note that a thread is about to wait for something the host might do.
+func (s *Scheduler) waitOnHost(t *Thread) {
+    s.lock.Lock()
+    t.external = true
+    s.hostWaits++
+    s.lock.Unlock()
+}
+
+func (s *Scheduler) wakeSleepers(now time.Time) {
+    for len(s.sleeping) > 0 && !s.sleeping[0].wake.After(now) {
+        t := heap.Pop(&s.sleeping).(*Thread)
+        s.wake(t, V{}, false)
+    }
+}
+
+// The result of a finished thread, or the value it threw.
+func (t *Thread) outcome() (V, bool) {
+    if t.p.err == nil {
+        return t.p.result, false
+    }
+    if e, ok := t.p.err.(*ScriptError); ok {
+        return e.Value, true
+    }
+    return String(t.p.err.Error()), true
+}
+
+// The result of the thread's process, as Process.Run would give it.
+func (t *Thread) Result() (V, error) {
+    if !t.done {
+        return V{}, ErrRunning
+    }
+    return t.p.result, t.p.err
+}
+
+func (t *Thread) park() Action {
+    t.parked = true
+    return Suspend()
+}
+
+// Sleeping threads are kept in order of when they wake, and then of when they
+// went to sleep.
+type sleepQueue []*Thread
+
+func (q sleepQueue) Len() int {
+    return len(q)
+}
+
+func (q sleepQueue) Less(i, j int) bool {
+    if q[i].wake.Equal(q[j].wake) {
+        return q[i].seq < q[j].seq
+    }
+    return q[i].wake.Before(q[j].wake)
+}
+
+func (q sleepQueue) Swap(i, j int) {
+    q[i], q[j] = q[j], q[i]
+}
+
+func (q *sleepQueue) Push(x interface{}) {
+    *q = append(*q, x.(*Thread))
+}
+
+func (q *sleepQueue) Pop() interface{} {
+    old := *q
+    end := len(old)-1
+    t := old[end]
+    old[end] = nil
+    *q = old[:end]
+    return t
+}
+
+func (e *Interpreter) initThreads() {
+    cs := &e.builtins.classes
+    cs.Thread = V{newClass(e.Intern("Thread"), cs.Object.val.(*class), nil, nil)}
+    e.defineBuiltins(cs.Thread, []builtinMember{
+        {"join", joinThread},
+    })
+    e.initChannels()
+    e.builtinPackage("thread", []builtinMember{
+        {"spawn", spawnThread},
+        {"current", currentThread},
+        {"yield", yieldThread},
+        {"sleep", sleepThread},
+        {"select", selectChannels},
+        {"trySelect", trySelectChannels},
+        {"Channel", cs.Channel},
+    })
+}
+
+func schedulerThread(p *Process) (*Thread, bool) {
+    return p.thread, p.thread != nil
+}
+
+var errNoScheduler = String("not running in a scheduler")
+
+// thread.spawn(f, args...) starts a thread that calls f with the arguments,
+// and returns the thread.
+func spawnThread(p *Process) Action {
+    t, ok := schedulerThread(p)
+    if !ok {
+        return Throw(errNoScheduler)
+    }
+    args := p.Args()
+    if len(args) == 0 {
+        return Throw(String("wrong number of arguments"))
+    }
+    if len(args) > 256 {
+        return Throw(String("too many arguments"))
+    }
+    child := &Process{host: p.host}
+    child.stack = append([]V(nil), args[1:]...)
+    child.slot = args[0]
+    child.code = Code{TCALL, byte(len(args)-1)}
+    return Return(V{t.sched.start(child)})
+}
+
+func currentThread(p *Process) Action {
+    t, ok := schedulerThread(p)
+    if !ok {
+        return Throw(errNoScheduler)
+    }
+    return Return(V{t})
+}
+
+func yieldThread(p *Process) Action {
+    t, ok := schedulerThread(p)
+    if !ok {
+        return Throw(errNoScheduler)
+    }
+    t.sched.wake(t, V{}, false)
+    return t.park()
+}
+
+func sleepThread(p *Process) Action {
+    t, ok := schedulerThread(p)
+    if !ok {
+        return Throw(errNoScheduler)
+    }
+    args := p.Args()
+    if len(args) != 1 {
+        return Throw(String("wrong number of arguments"))
+    }
+    ms, ok := args[0].AsInt()
+    if !ok {
+        return Throw(String("argument 1: expected Integer"))
+    }
+    s := t.sched
+    s.seq++
+    t.seq = s.seq
+    t.wake = time.Now().Add(time.Duration(ms) * time.Millisecond)
+    heap.Push(&s.sleeping, t)
+    return t.park()
+}
+
+// Joining a thread that threw a value throws the same value.
+func joinThread(p *Process) Action {
+    t, ok := schedulerThread(p)
+    if !ok {
+        return Throw(errNoScheduler)
+    }
+    target := p.Receiver().val.(*Thread)
+    if target == t {
+        return Throw(String("thread cannot join itself"))
+    }
+    if target.sched != t.sched {
+        return Throw(String("thread belongs to another scheduler"))
+    }
+    if target.done {
+        x, thrown := target.outcome()
+        if thrown {
+            return Throw(x)
+        }
+        return Return(x)
+    }
+    target.joiners = append(target.joiners, t)
+    return t.park()
+}
@@ -0,0 +1,324 @@
+package script
+
+import (
+    "strings"
+    "testing"
+)
+
+const threadSource = `
+    .import thread thread
+
+    .class Worker
+    .field log
+
+    ; Counts from the first argument to the second, then logs the second.
+    .method count 2
+        FRAME compared
+        BOUND 1
+        PUSH
+        BOUND 0
+        LOOKUP lt
+        CALL 1
+    compared:
+        BRANCH done
+        FRAME added
+        GLOBAL 1
+        PUSH
+        BOUND 0
+        LOOKUP add
+        CALL 1
+    added:
+        PUSH
+        BOUND 1
+        PUSH
+        THIS
+        LOOKUP count
+        TCALL 2
+    done:
+        BOUND 1
+        PUSH
+        THIS
+        LOOKUP log
+        GET
+        LOOKUP append
+        TCALL 1
+
+    ; Logs the first argument the second number of times, yielding after each.
+    .method steps 2
+        FRAME logged
+        BOUND 0
+        PUSH
+        THIS
+        LOOKUP log
+        GET
+        LOOKUP append
+        CALL 1
+    logged:
+        FRAME yielded
+        GLOBAL thread
+        LOOKUP yield
+        CALL 0
+    yielded:
+        FRAME compared
+        GLOBAL 1
+        PUSH
+        BOUND 1
+        LOOKUP gt
+        CALL 1
+    compared:
+        BRANCH done
+        BOUND 0
+        PUSH
+        FRAME subtracted
+        GLOBAL 1
+        PUSH
+        BOUND 1
+        LOOKUP sub
+        CALL 1
+    subtracted:
+        PUSH
+        THIS
+        LOOKUP steps
+        TCALL 2
+    done:
+        RETURN
+
+    ; Sleeps for the argument in milliseconds, then logs it.
+    .method nap 1
+        FRAME slept
+        BOUND 0
+        PUSH
+        GLOBAL thread
+        LOOKUP sleep
+        CALL 1
+    slept:
+        BOUND 0
+        PUSH
+        THIS
+        LOOKUP log
+        GET
+        LOOKUP append
+        TCALL 1
+
+    ; Joins the thread at the start of the log.
+    .method waitFirst 0
+        FRAME got
+        GLOBAL 0
+        PUSH
+        THIS
+        LOOKUP log
+        GET
+        LOOKUP at
+        CALL 1
+    got:
+        LOOKUP join
+        TCALL 0
+    .end
+
+    ; Calls the first argument with the second in a new thread and returns
+    ; what joining the thread gives.
+    .method spawnJoin 2
+        GLOBAL handler
+        HANDLE
+        FRAME spawned
+        BOUND 0
+        PUSH
+        BOUND 1
+        PUSH
+        GLOBAL thread
+        LOOKUP spawn
+        CALL 2
+    spawned:
+        LOOKUP join
+        TCALL 0
+        RETURN
+
+    .method handler 1
+        BOUND 0
+        PUSH
+        GLOBAL "caught: "
+        LOOKUP concat
+        TCALL 1
+
+    .method double 1
+        GLOBAL 2
+        PUSH
+        BOUND 0
+        LOOKUP mul
+        TCALL 1
+
+    .method fail 1
+        BOUND 0
+        THROW
+
+    .method joinSelf 0
+        GLOBAL handler
+        HANDLE
+        FRAME got
+        GLOBAL thread
+        LOOKUP current
+        CALL 0
+    got:
+        LOOKUP join
+        TCALL 0
+        RETURN
+
+    .method yield 0
+        GLOBAL thread
+        LOOKUP yield
+        TCALL 0
+`
+
+type threadTest struct {
+    host *Interpreter
+    unit *Unit
+    asm *Assembly
+}
+
+func newThreadTest(t *testing.T, src string) *threadTest {
+    host := New()
+    u, a := assembleUnit(t, host, src)
+    return &threadTest{host, u, a}
+}
+
+func (tt *threadTest) value(name string) V {
+    entry, _ := tt.asm.Entry(name)
+    return tt.unit.Values[entry]
+}
+
+func (tt *threadTest) worker(log V) V {
+    obj, _ := tt.host.New(tt.value("Worker"), log)
+    return obj
+}
+
+func (tt *threadTest) spawn(t *testing.T, s *Scheduler, name string, this V, args ...V) *Thread {
+    entry, _ := tt.asm.Entry(name)
+    th, err := s.Spawn(tt.unit, entry, this, args...)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return th
+}
+
+func TestPreemption(t *testing.T) {
+    tt := newThreadTest(t, threadSource)
+    for i, test := range ([]struct{quantum int; log V}{
+        {50, arrayOf(1, 2000)},
+        {100000, arrayOf(2000, 1)},
+    }) {
+        s := tt.host.NewScheduler()
+        s.Quantum = test.quantum
+        log := Array()
+        w := tt.worker(log)
+        tt.spawn(t, s, "Worker.count", w, Int(0), Int(2000))
+        tt.spawn(t, s, "Worker.count", w, Int(0), Int(1))
+        if err := s.Run(); err != nil {
+            t.Fatalf("[%d]: %v", i, err)
+        }
+        if !sameArray(log, test.log) {
+            t.Errorf("[%d]: log is %v", i, *log.val.(*[]V))
+        }
+    }
+}
+
+func TestManyThreads(t *testing.T) {
+    tt := newThreadTest(t, threadSource)
+    s := tt.host.NewScheduler()
+    s.Quantum = 7
+    log := Array()
+    w := tt.worker(log)
+    threads := make([]*Thread, 2000)
+    for i := range threads {
+        threads[i] = tt.spawn(t, s, "Worker.count", w, Int(0), Int(20))
+    }
+    if err := s.Run(); err != nil {
+        t.Fatal(err)
+    }
+    if n := len(*log.val.(*[]V)); n != len(threads) {
+        t.Errorf("%d entries logged", n)
+    }
+    for i, th := range threads {
+        if _, err := th.Result(); err != nil {
+            t.Errorf("[%d]: %v", i, err)
+        }
+    }
+}
+
+func TestYield(t *testing.T) {
+    tt := newThreadTest(t, threadSource)
+    s := tt.host.NewScheduler()
+    log := Array()
+    w := tt.worker(log)
+    tt.spawn(t, s, "Worker.steps", w, String("a"), Int(3))
+    tt.spawn(t, s, "Worker.steps", w, String("b"), Int(2))
+    if err := s.Run(); err != nil {
+        t.Fatal(err)
+    }
+    expected := Array(String("a"), String("b"), String("a"), String("b"), String("a"))
+    if !sameArray(log, expected) {
+        t.Errorf("log is %v", *log.val.(*[]V))
+    }
+}
+
+func TestSleep(t *testing.T) {
+    tt := newThreadTest(t, threadSource)
+    s := tt.host.NewScheduler()
+    log := Array()
+    w := tt.worker(log)
+    for _, ms := range []int64{30, 10, 20, 0} {
+        tt.spawn(t, s, "Worker.nap", w, Int(ms))
+    }
+    if err := s.Run(); err != nil {
+        t.Fatal(err)
+    }
+    if !sameArray(log, arrayOf(0, 10, 20, 30)) {
+        t.Errorf("log is %v", *log.val.(*[]V))
+    }
+}
+
+func TestJoin(t *testing.T) {
+    tt := newThreadTest(t, threadSource)
+    for i, test := range ([]struct{entry string; args []V; result V}{
+        {"spawnJoin", []V{tt.value("double"), Int(21)}, Int(42)},
+        {"spawnJoin", []V{tt.value("fail"), String("boom")}, String("caught: boom")},
+        {"joinSelf", nil, String("caught: thread cannot join itself")},
+    }) {
+        s := tt.host.NewScheduler()
+        th := tt.spawn(t, s, test.entry, V{}, test.args...)
+        if _, err := th.Result(); err != ErrRunning {
+            t.Errorf("[%d]: result before running: %v", i, err)
+        }
+        if err := s.Run(); err != nil {
+            t.Errorf("[%d]: %v", i, err)
+            continue
+        }
+        result, err := th.Result()
+        if err != nil {
+            t.Errorf("[%d]: %v", i, err)
+        }
+        if result != test.result {
+            t.Errorf("[%d]: %#v != %#v", i, result, test.result)
+        }
+    }
+}
+
+func TestDeadlock(t *testing.T) {
+    tt := newThreadTest(t, threadSource)
+    s := tt.host.NewScheduler()
+    first := Array(Nil())
+    a := tt.spawn(t, s, "Worker.waitFirst", tt.worker(first))
+    b := tt.spawn(t, s, "Worker.waitFirst", tt.worker(Array(V{a})))
+    (*first.val.(*[]V))[0] = V{b}
+    if err := s.Run(); err != ErrDeadlock {
+        t.Errorf("expected deadlock, got %v", err)
+    }
+}
+
+func TestNoScheduler(t *testing.T) {
+    tt := newThreadTest(t, threadSource)
+    entry, _ := tt.asm.Entry("yield")
+    _, err := tt.host.Run(tt.unit, entry, V{})
+    if err == nil || !strings.Contains(err.Error(), "not running in a scheduler") {
+        t.Errorf("unexpected error %v", err)
+    }
+}
@@ -0,0 +1,105 @@
+package script
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// The file extensions of package sources and images.
+const (
+    SourceExt = ".asm"
+    ImageExt = ".img"
+)
+
+// A PackageSource that looks for packages in a list of directories. The package
+// "a.b" is found at a/b.img or a/b.asm within one of the directories, which are
+// searched in order.
+//
+// Sources are compiled when they are opened and the image is cached next to the
+// source, named after a hash of its contents, e.g. a/b.1f2e3d4c5b6a7988.img.
+// While the source is unchanged, later searches read the cached image instead.
+type SearchPath struct {
+    Dirs []string
+    // Turns a source into an image. If nil, sources are assembled.
+    Compile func(src string) (io.WriterTo, error)
+}
+
+func (s *SearchPath) OpenPackage(path string) (io.ReadCloser, error) {
+    rel := filepath.Join(strings.Split(path, ".")...)
+    for _, dir := range s.Dirs {
+        base := filepath.Join(dir, rel)
+        if f, err := os.Open(base + ImageExt); err == nil {
+            return f, nil
+        }
+        src, err := os.ReadFile(base + SourceExt)
+        if os.IsNotExist(err) {
+            continue
+        }
+        if err != nil {
+            return nil, err
+        }
+        return s.openSource(base, src)
+    }
+    return nil, ErrNoPackage
+}
+
+func (s *SearchPath) openSource(base string, src []byte) (io.ReadCloser, error) {
+    sum := sha256.Sum256(src)
+    cached := base + "." + hex.EncodeToString(sum[:8]) + ImageExt
+    if f, err := os.Open(cached); err == nil {
+        return f, nil
+    }
+    compile := s.Compile
+    if compile == nil {
+        compile = assembleSource
+    }
+    img, err := compile(string(src))
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", base + SourceExt, err)
+    }
+    buf := new(bytes.Buffer)
+    if _, err := img.WriteTo(buf); err != nil {
+        return nil, err
+    }
+    // The cache is only an optimisation, so failing to write it is not an
+    // error.
+    writeCache(base, cached, buf.Bytes())
+    return io.NopCloser(buf), nil
+}
+
+func assembleSource(src string) (io.WriterTo, error) {
+    return Assemble(src)
+}
+
+// Replace any images cached for earlier versions of the source with the new
+// one. The image is written to a temporary file first so that other processes
+// never see part of it.
+func writeCache(base, cached string, img []byte) {
+    old, _ := filepath.Glob(base + ".*" + ImageExt)
+    f, err := os.CreateTemp(filepath.Dir(base), filepath.Base(base) + ".tmp*")
+    if err != nil {
+        return
+    }
+    _, err = f.Write(img)
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    if err == nil {
+        err = os.Rename(f.Name(), cached)
+    }
+    if err != nil {
+        os.Remove(f.Name())
+        return
+    }
+    for _, name := range old {
+        if name != cached {
+            os.Remove(name)
+        }
+    }
+}
@@ -0,0 +1,78 @@
+package script
+
+import (
+    "testing"
+    "bytes"
+    "errors"
+    "io"
+    "os"
+    "path/filepath"
+    "strconv"
+)
+
+func TestSearchPath(t *testing.T) {
+    first, second := t.TempDir(), t.TempDir()
+    write := func(name, src string) {
+        if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+            t.Fatal(err)
+        }
+        if err := os.WriteFile(name, []byte(src), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    listing := func(pkg string, answer int) string {
+        return ".package " + pkg + "\n.const answer " + strconv.Itoa(answer) + "\n.export answer\n"
+    }
+    write(filepath.Join(first, "lib", "a.asm"), listing("lib.a", 1))
+    a, err := Assemble(listing("lib.b", 2))
+    if err != nil {
+        t.Fatal(err)
+    }
+    img := new(bytes.Buffer)
+    a.WriteTo(img)
+    write(filepath.Join(second, "lib", "b.img"), img.String())
+    compiled := 0
+    search := &SearchPath{
+        Dirs: []string{first, second},
+        Compile: func(src string) (io.WriterTo, error) {
+            compiled++
+            return Assemble(src)
+        },
+    }
+    answer := func(path string) V {
+        host := New()
+        host.SetPackageSource(search)
+        pkg, err := host.Import(path)
+        if err != nil {
+            t.Fatal(err)
+        }
+        x, _ := pkg.val.(*UserObject).class.val.(*class).lookup(host.Intern("answer"))
+        return x
+    }
+    cached := func() []string {
+        names, _ := filepath.Glob(filepath.Join(first, "lib", "a.*.img"))
+        return names
+    }
+
+    if x := answer("lib.a"); x != Int(1) || compiled != 1 || len(cached()) != 1 {
+        t.Errorf("first load: %#v, compiled %d, cached %v", x, compiled, cached())
+    }
+    if x := answer("lib.a"); x != Int(1) || compiled != 1 {
+        t.Errorf("cached load: %#v, compiled %d", x, compiled)
+    }
+    write(filepath.Join(first, "lib", "a.asm"), listing("lib.a", 3))
+    if x := answer("lib.a"); x != Int(3) || compiled != 2 || len(cached()) != 1 {
+        t.Errorf("changed source: %#v, compiled %d, cached %v", x, compiled, cached())
+    }
+    if x := answer("lib.b"); x != Int(2) || compiled != 2 {
+        t.Errorf("image: %#v, compiled %d", x, compiled)
+    }
+    if _, err := search.OpenPackage("lib.c"); err != ErrNoPackage {
+        t.Errorf("unexpected error %v", err)
+    }
+    write(filepath.Join(first, "bad.asm"), "BOGUS")
+    var aerr *AsmError
+    if _, err := search.OpenPackage("bad"); !errors.As(err, &aerr) {
+        t.Errorf("unexpected error %v", err)
+    }
+}
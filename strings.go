@@ -0,0 +1,134 @@
+package script
+
+import (
+    "errors"
+    "fmt"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// Strings hold UTF-8 text. Lengths, indexes and slices count runes, apart from
+// byteLength, and iterating over a string gives each rune as a string.
+func (e *Interpreter) initStrings() {
+    cs := e.builtins.classes
+    e.defineBuiltins(cs.String, []builtinMember{
+        {"length", utf8.RuneCountInString},
+        {"byteLength", func(s string) int { return len(s) }},
+        {"at", stringAt},
+        {"slice", stringSlice},
+        {"concat", func(s, t string) string { return s + t }},
+        {"indexOf", stringIndex},
+        {"contains", strings.Contains},
+        {"split", stringSplit},
+        {"join", stringJoin},
+        {"trim", strings.TrimSpace},
+        {"upper", strings.ToUpper},
+        {"lower", strings.ToLower},
+        {"replace", func(s, old, new string) string { return strings.ReplaceAll(s, old, new) }},
+        {"hasPrefix", strings.HasPrefix},
+        {"hasSuffix", strings.HasSuffix},
+        {"toInteger", stringToInteger},
+        {"toFloat", stringToFloat},
+        {"iterator", func(p *Process, s string) V { return p.host.newIterator(String(s)) }},
+    })
+    e.defineBuiltins(cs.Integer, []builtinMember{
+        {"toString", func(x int64) string { return strconv.FormatInt(x, 10) }},
+    })
+    e.defineBuiltins(cs.Float, []builtinMember{
+        {"toString", func(x float64) string { return strconv.FormatFloat(x, 'g', -1, 64) }},
+    })
+}
+
+var errStringIndex = errors.New("index out of range")
+
+// Find the byte offset of the rune at index i. The index may be the length of
+// the string.
+func runeOffset(s string, i int) (int, error) {
+    if i < 0 {
+        return 0, errStringIndex
+    }
+    for offset := range s {
+        if i == 0 {
+            return offset, nil
+        }
+        i--
+    }
+    if i == 0 {
+        return len(s), nil
+    }
+    return 0, errStringIndex
+}
+
+func stringAt(s string, i int) (string, error) {
+    offset, err := runeOffset(s, i)
+    if err != nil || offset == len(s) {
+        return "", errStringIndex
+    }
+    _, size := utf8.DecodeRuneInString(s[offset:])
+    return s[offset:offset+size], nil
+}
+
+// slice(from, to) returns the runes from from up to, but not including, to.
+func stringSlice(s string, from, to int) (string, error) {
+    start, err := runeOffset(s, from)
+    if err != nil {
+        return "", err
+    }
+    end, err := runeOffset(s, to)
+    if err != nil || end < start {
+        return "", errStringIndex
+    }
+    return s[start:end], nil
+}
+
+// indexOf(t) returns the index of the first rune of t in the receiver, or -1.
+func stringIndex(s, t string) int {
+    offset := strings.Index(s, t)
+    if offset == -1 {
+        return -1
+    }
+    return utf8.RuneCountInString(s[:offset])
+}
+
+func stringSplit(s, sep string) V {
+    var parts []V
+    for _, part := range strings.Split(s, sep) {
+        parts = append(parts, String(part))
+    }
+    return Array(parts...)
+}
+
+// The receiver of join is the separator and the argument is an array of
+// strings.
+func stringJoin(sep string, parts V) (string, error) {
+    a, ok := parts.AsArray()
+    if !ok {
+        return "", errors.New("argument 1: expected Array")
+    }
+    strs := make([]string, len(*a))
+    for i, x := range *a {
+        str, ok := x.AsString()
+        if !ok {
+            return "", fmt.Errorf("element %d: expected String", i)
+        }
+        strs[i] = str
+    }
+    return strings.Join(strs, sep), nil
+}
+
+func stringToInteger(s string) (int64, error) {
+    x, err := strconv.ParseInt(s, 10, 64)
+    if err != nil {
+        return 0, fmt.Errorf("not an integer: %q", s)
+    }
+    return x, nil
+}
+
+func stringToFloat(s string) (float64, error) {
+    x, err := strconv.ParseFloat(s, 64)
+    if err != nil {
+        return 0, fmt.Errorf("not a number: %q", s)
+    }
+    return x, nil
+}
@@ -0,0 +1,74 @@
+package script
+
+import (
+    "testing"
+)
+
+func TestStrings(t *testing.T) {
+    host := New()
+    for i, test := range ([]struct{recv V; name string; args []V; result V; thrown string}{
+        {String("héllo"), "length", nil, Int(5), ""},
+        {String("héllo"), "byteLength", nil, Int(6), ""},
+        {String("héllo"), "at", []V{Int(1)}, String("é"), ""},
+        {String("héllo"), "at", []V{Int(5)}, V{}, "index out of range"},
+        {String("héllo"), "slice", []V{Int(1), Int(3)}, String("él"), ""},
+        {String("héllo"), "slice", []V{Int(5), Int(5)}, String(""), ""},
+        {String("héllo"), "slice", []V{Int(3), Int(1)}, V{}, "index out of range"},
+        {String("héllo"), "slice", []V{Int(0), Int(6)}, V{}, "index out of range"},
+        {String("ab"), "concat", []V{String("cd")}, String("abcd"), ""},
+        {String("héllo"), "indexOf", []V{String("llo")}, Int(2), ""},
+        {String("héllo"), "indexOf", []V{String("x")}, Int(-1), ""},
+        {String("héllo"), "contains", []V{String("él")}, V{true}, ""},
+        {String(", "), "join", []V{Array(String("a"), String("b"))}, String("a, b"), ""},
+        {String(", "), "join", []V{Array(Int(1))}, V{}, "element 0: expected String"},
+        {String("  x \n"), "trim", nil, String("x"), ""},
+        {String("éa"), "upper", nil, String("ÉA"), ""},
+        {String("ÀB"), "lower", nil, String("àb"), ""},
+        {String("a-b-c"), "replace", []V{String("-"), String("+")}, String("a+b+c"), ""},
+        {String("prefix"), "hasPrefix", []V{String("pre")}, V{true}, ""},
+        {String("prefix"), "hasSuffix", []V{String("pre")}, V{false}, ""},
+        {String("-42"), "toInteger", nil, Int(-42), ""},
+        {String("4x"), "toInteger", nil, V{}, `not an integer: "4x"`},
+        {String("2.5"), "toFloat", nil, Float(2.5), ""},
+        {String("x"), "toFloat", nil, V{}, `not a number: "x"`},
+        {Int(-7), "toString", nil, String("-7"), ""},
+        {Float(0.5), "toString", nil, String("0.5"), ""},
+    }) {
+        result, err := host.Run(sendUnit(test.recv, host.Intern(test.name), test.args...), 0, V{})
+        if test.thrown != "" {
+            if serr, ok := err.(*ScriptError); !ok || serr.Value != String(test.thrown) {
+                t.Errorf("[%d]: unexpected error %v", i, err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("[%d]: unexpected error %v", i, err)
+        }
+        if result != test.result {
+            t.Errorf("[%d]: %#v != %#v", i, result, test.result)
+        }
+    }
+}
+
+func TestStringSplitAndIterate(t *testing.T) {
+    host := New()
+    send := func(recv V, name string, args ...V) V {
+        result, err := host.Run(sendUnit(recv, host.Intern(name), args...), 0, V{})
+        if err != nil {
+            t.Fatal(err)
+        }
+        return result
+    }
+    parts := send(String("a,é,"), "split", String(","))
+    if !sameArray(parts, Array(String("a"), String("é"), String(""))) {
+        t.Errorf("split gave %v", parts)
+    }
+    it := send(String("aé😀"), "iterator")
+    var runes []V
+    for send(it, "hasNext").AsBool() {
+        runes = append(runes, send(it, "next"))
+    }
+    if !sameArray(Array(runes...), Array(String("a"), String("é"), String("😀"))) {
+        t.Errorf("iterated %v", runes)
+    }
+}
@@ -0,0 +1,235 @@
+package script
+
+import (
+    "fmt"
+    "io"
+)
+
+// Describes why a method failed verification.
+type VerifyError struct {
+    Method string
+    Offset int
+    Msg string
+}
+
+func (e *VerifyError) Error() string {
+    return fmt.Sprintf("%s+%d: %s", e.Method, e.Offset, e.Msg)
+}
+
+// Read an image and check that all of its methods are safe to run before
+// linking it into its package. Packages that it imports are checked too. An
+// image that fails leaves nothing behind, so a corrected one can be loaded.
+func (host *Interpreter) LoadVerified(input io.Reader) (*Unit, error) {
+    host.packagesLock.Lock()
+    defer host.packagesLock.Unlock()
+    verify := host.verifyImports
+    host.verifyImports = true
+    defer func() {
+        host.verifyImports = verify
+    }()
+    l, err := host.decode(input)
+    if err != nil {
+        return nil, err
+    }
+    if err := l.unit.Verify(); err != nil {
+        return nil, err
+    }
+    return l.link()
+}
+
+// Check the packages that Import finds, and that images import, in the same
+// way as LoadVerified.
+func (host *Interpreter) SetVerifyImports(verify bool) {
+    host.packagesLock.Lock()
+    defer host.packagesLock.Unlock()
+    host.verifyImports = verify
+}
+
+// Check every method in the unit. The error, if any, is a *VerifyError.
+func (u *Unit) Verify() error {
+    for _, x := range u.Values {
+        if m, ok := x.val.(*method); ok {
+            if err := m.verify(); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// Check that a method will not cause the interpreter to fail. Every
+// instruction must be whole and valid, and every operand must be in range.
+// Each instruction must also be reached with the same number of values on the
+// stack however control gets there, and control must not run off the end of
+// the code.
+//
+// Calls return to the continuation saved by the most recent FRAME, so they are
+// treated as the end of a block and FRAME as a branch to its continuation.
+// THROW ends a block too. If a handler might have been installed in the frame,
+// then whatever a call or THROW throws may be caught, and the handler's result
+// arrives at the next instruction with the stack as it was before. Other
+// instructions that can throw leave the stack as they would have anyway.
+func (m *method) verify() error {
+    v := &verifier{m: m, depths: make([]int, len(m.code)), handled: make([]bool, len(m.code))}
+    for i := range v.depths {
+        v.depths[i] = -1
+    }
+    if err := v.decode(); err != nil {
+        return err
+    }
+    v.reach(0, 0, m.argc, false)
+    for v.err == nil && len(v.work) > 0 {
+        pos := v.work[len(v.work)-1]
+        v.work = v.work[:len(v.work)-1]
+        if err := v.step(pos); err != nil {
+            return err
+        }
+    }
+    if v.err != nil {
+        return v.err
+    }
+    return nil
+}
+
+type verifier struct {
+    m *method
+    starts []bool
+    depths []int
+    // Whether a handler might be installed when each instruction runs.
+    handled []bool
+    work []int
+    err *VerifyError
+}
+
+func (v *verifier) fail(pos int, format string, args ...interface{}) *VerifyError {
+    name := "?"
+    if v.m.name != nil {
+        name = v.m.name.String()
+    }
+    return &VerifyError{name, pos, fmt.Sprintf(format, args...)}
+}
+
+// Find where each instruction starts and check that it is whole.
+func (v *verifier) decode() error {
+    code := v.m.code
+    v.starts = make([]bool, len(code))
+    for pos := 0; pos < len(code); {
+        op := int(code[pos])
+        if op >= len(opcodes) || op == RESUME {
+            return v.fail(pos, "invalid opcode %d", op)
+        }
+        v.starts[pos] = true
+        pos += 1 + opcodes[op].operand
+        if pos > len(code) {
+            return v.fail(pos - 1 - opcodes[op].operand, "truncated %s", opcodes[op].name)
+        }
+    }
+    return nil
+}
+
+// Note that control passes from the instruction at from to pos, with depth
+// values on the stack. Any problem is reported against the instruction at from.
+func (v *verifier) reach(from, pos, depth int, handled bool) {
+    if v.err != nil {
+        return
+    }
+    if pos >= len(v.m.code) {
+        v.err = v.fail(from, "control passes the end of the code")
+        return
+    }
+    if !v.starts[pos] {
+        v.err = v.fail(from, "%d is not the start of an instruction", pos)
+        return
+    }
+    switch v.depths[pos] {
+    case -1:
+        v.depths[pos] = depth
+        v.handled[pos] = handled
+        v.work = append(v.work, pos)
+    case depth:
+        // Look at the instruction again now that more can happen after it.
+        if handled && !v.handled[pos] {
+            v.handled[pos] = true
+            v.work = append(v.work, pos)
+        }
+    default:
+        v.err = v.fail(from, "stack depth %d at %d does not match %d", depth, pos, v.depths[pos])
+    }
+}
+
+func (v *verifier) step(pos int) error {
+    code, values := v.m.code, v.m.unit.Values
+    op := int(code[pos])
+    depth := v.depths[pos]
+    handled := v.handled[pos]
+    reach := func(to, depth int) {
+        v.reach(pos, to, depth, handled)
+    }
+    x := operandAt(code, pos+1, opcodes[op].operand)
+    next := pos + 1 + opcodes[op].operand
+    need := func(n int) error {
+        if depth < n {
+            return v.fail(pos, "%s needs %d values on the stack but there are %d", opcodes[op].name, n, depth)
+        }
+        return nil
+    }
+    // The handler is removed before it is called.
+    caught := func() {
+        if handled {
+            v.reach(pos, next, depth, false)
+        }
+    }
+    switch op {
+    case HALT, RETURN:
+    case THROW, TGET:
+        caught()
+    case HANDLE:
+        v.reach(pos, next, depth, true)
+    case THIS, FREE, GET, LOAD:
+        reach(next, depth)
+    case BOUND, CELL:
+        if err := need(x+1); err != nil {
+            return err
+        }
+        reach(next, depth)
+    case GLOBAL:
+        if x >= len(values) {
+            return v.fail(pos, "constant %d out of range", x)
+        }
+        reach(next, depth)
+    case LOOKUP:
+        if x >= len(values) {
+            return v.fail(pos, "constant %d out of range", x)
+        }
+        if _, ok := values[x].val.(*Name); !ok {
+            return v.fail(pos, "constant %d is not a name", x)
+        }
+        reach(next, depth)
+    case PUSH:
+        reach(next, depth+1)
+    case SET, STORE:
+        if err := need(1); err != nil {
+            return err
+        }
+        reach(next, depth-1)
+    case CLOSURE:
+        if err := need(x); err != nil {
+            return err
+        }
+        reach(next, depth-x)
+    case CALL, TCALL:
+        if err := need(x); err != nil {
+            return err
+        }
+        caught()
+    case JUMP:
+        reach(x, depth)
+    case BRANCH:
+        reach(x, depth)
+        reach(next, depth)
+    case FRAME:
+        reach(x, depth)
+        reach(next, depth)
+    }
+    return nil
+}
@@ -0,0 +1,151 @@
+package script
+
+import (
+    "testing"
+    "bytes"
+    "errors"
+    "io"
+
+    "github.com/bobappleyard/script/bytecode"
+)
+
+func TestVerify(t *testing.T) {
+    for i, test := range ([]struct{src string; offset int}{
+        {`
+            FRAME done
+            GLOBAL 1
+            PUSH
+            GLOBAL 2
+            LOOKUP foo
+            CALL 1
+        done:
+            BRANCH other
+            BOUND 0
+            RETURN
+        other:
+            THROW
+        `, -1},
+        {"PUSH", 0},
+        {"JUMP 1\nRETURN", 0},
+        {"JUMP 100", 0},
+        {"GLOBAL 1\nBRANCH x\nPUSH\nx:\nRETURN", 8},
+        {"BOUND 1\nRETURN", 0},
+        {"SET\nSET\nRETURN", 1},
+        {"CALL 2", 0},
+        {"FRAME 2\nTHIS\nRETURN", 0},
+        {"GLOBAL 1\nHANDLE\nTHIS\nTHROW\nRETURN", -1},
+        // A caught throw continues at the next instruction.
+        {"GLOBAL 1\nHANDLE\nTHIS\nTHROW\nBOUND 5\nRETURN", 8},
+        {"GLOBAL 1\nHANDLE\nTHIS\nTHROW", 7},
+        // So does a caught call, with its arguments still on the stack.
+        {"FRAME done\nGLOBAL 1\nHANDLE\nGLOBAL 1\nLOOKUP add\nCALL 0\nBOUND 9\nRETURN\ndone:\nRETURN", 21},
+        {"GLOBAL 1\nHANDLE\nGLOBAL 1\nPUSH\nLOOKUP add\nCALL 1\nBOUND 1\nRETURN", -1},
+        {"GLOBAL 1\nHANDLE\nGLOBAL 1\nPUSH\nLOOKUP add\nTCALL 1", 17},
+    }) {
+        host := New()
+        u, a := assembleUnit(t, host, ".method main 1\n" + test.src)
+        entry, _ := a.Entry("main")
+        err := u.Values[entry].val.(*method).verify()
+        if test.offset == -1 {
+            if err != nil {
+                t.Errorf("[%d]: unexpected error %v", i, err)
+            }
+            continue
+        }
+        verr, ok := err.(*VerifyError)
+        if !ok {
+            t.Errorf("[%d]: expected a verify error, got %v", i, err)
+            continue
+        }
+        if verr.Method != "main" || verr.Offset != test.offset {
+            t.Errorf("[%d]: unexpected error %v", i, verr)
+        }
+    }
+}
+
+func TestVerifyCode(t *testing.T) {
+    u := &Unit{Values: []V{Int(1)}}
+    for i, test := range ([]struct{code Code; offset int}{
+        {Code{}, 0},
+        {Code{99}, 0},
+        {Code{RESUME}, 0},
+        {Code{THIS, GLOBAL, 0,0}, 1},
+        {Code{GLOBAL, 1,0,0,0, RETURN}, 0},
+        {Code{LOOKUP, 0,0,0,0, RETURN}, 0},
+        {Code{THIS, PUSH, CLOSURE, 2, RETURN}, 2},
+        {Code{CELL, 0, RETURN}, 0},
+        {Code{THIS, STORE, RETURN}, 1},
+    }) {
+        err := newMethod(nil, 0, test.code, u).verify()
+        verr, ok := err.(*VerifyError)
+        if !ok || verr.Offset != test.offset {
+            t.Errorf("[%d]: unexpected error %v", i, err)
+        }
+    }
+}
+
+func TestLoadVerified(t *testing.T) {
+    w := bytecode.NewWriter(ImageLayout)
+    name := w.Compound(NameType, w.Bytes([]byte("main")))
+    w.Compound(MethodType, name, w.Bytes([]byte{GLOBAL, 9,0,0,0, RETURN}), w.Int(0))
+    buf := new(bytes.Buffer)
+    w.WriteTo(buf)
+    if _, err := New().LoadVerified(buf); err == nil {
+        t.Error("expected an error")
+    }
+}
+
+func TestLoadVerifiedPackages(t *testing.T) {
+    src := &testSource{t, map[string]string{
+        "evil": `
+            .package evil
+            .method run 0
+                BOUND 9
+                RETURN
+            .export run
+        `,
+        "good": `
+            .package evil
+            .method run 0
+                THIS
+                RETURN
+            .export run
+        `,
+        "uses": `
+            .import evil evil
+        `,
+    }, map[string]int{}}
+    open := func(path string) io.Reader {
+        r, _ := src.OpenPackage(path)
+        return r
+    }
+    host := New()
+    var verr *VerifyError
+    if _, err := host.LoadVerified(open("evil")); !errors.As(err, &verr) {
+        t.Errorf("unexpected error %v", err)
+    }
+    // The image that failed was not linked.
+    if _, err := host.Import("evil"); !errors.Is(err, ErrNoPackage) {
+        t.Errorf("unexpected error %v", err)
+    }
+    if _, err := host.LoadVerified(open("good")); err != nil {
+        t.Errorf("unexpected error %v", err)
+    }
+    if _, err := host.Import("evil"); err != nil {
+        t.Errorf("unexpected error %v", err)
+    }
+    // Imports are verified while loading a verified image, or when asked.
+    host = New()
+    host.SetPackageSource(src)
+    if _, err := host.LoadVerified(open("uses")); !errors.As(err, &verr) {
+        t.Errorf("unexpected error %v", err)
+    }
+    host.SetVerifyImports(true)
+    if _, err := host.Import("evil"); !errors.As(err, &verr) {
+        t.Errorf("unexpected error %v", err)
+    }
+    host.SetVerifyImports(false)
+    if _, err := host.Import("evil"); err != nil {
+        t.Errorf("unexpected error %v", err)
+    }
+}